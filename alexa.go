@@ -1,8 +1,8 @@
 package hellfire // import "pathspider.net/hellfire"
 
 import (
-	"archive/zip"
-	"log"
+	"context"
+	"fmt"
 )
 
 type AlexaTopsitesList struct {
@@ -13,39 +13,43 @@ type AlexaTopsitesList struct {
 // URL to download the latest Alexa Topsites list from
 const AlexaTopsitesURL string = "http://s3.amazonaws.com/alexa-static/top-1m.csv.zip"
 
+func init() {
+	RegisterSource(Source{
+		Name: "topsites",
+		New: func(options map[string]string) (TestList, error) {
+			l := new(AlexaTopsitesList)
+			l.SetFilename(options[FileOption])
+			return l, nil
+		},
+	})
+}
+
 func (l *AlexaTopsitesList) SetFilename(filename string) {
 	l.filename = filename
 }
 
 func (l *AlexaTopsitesList) FeedJobs(jobs chan map[string]interface{}) {
+	feedJobs(l, jobs)
+}
+
+func (l *AlexaTopsitesList) Feed(ctx context.Context, jobs chan map[string]interface{}) error {
 	var topsites *CSVList
 
 	if l.filename == "" {
-		urlReader, err := getReaderFromUrl(AlexaTopsitesURL)
+		urlReader, source, err := getReaderFromSource("topsites")
 		if err != nil {
-			log.Fatalf("Unable to get <%s>: %s", AlexaTopsitesURL, err)
+			return fmt.Errorf("unable to get <%s>: %s", source, err)
 		}
 
-		zr, err := zip.NewReader(urlReader, int64(urlReader.Len()))
+		topsites = CSVListFromReader(urlReader)
+	} else {
+		var err error
+		topsites, err = OpenCSVList(l.filename)
 		if err != nil {
-			log.Fatalf("Unable to read zip: %s", err)
+			return err
 		}
-
-		for _, zf := range zr.File {
-			if zf.Name == "top-1m.csv" {
-				f, _ := zf.Open()
-				topsites = CSVListFromReader(f)
-				break
-			}
-		}
-
-		if topsites == nil {
-			panic("Did not find top-1m.csv in the zip archive")
-		}
-	} else {
-		topsites = CSVListFromFile(l.filename)
 	}
 
 	topsites.SetHeader([]string{"rank", "domain"})
-	topsites.FeedJobs(jobs)
+	return topsites.Feed(ctx, jobs)
 }
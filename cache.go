@@ -0,0 +1,107 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// The directory in which downloaded lists are cached. Caching is disabled
+// when this is empty.
+var cacheDir string
+
+// Whether only cached copies of lists may be used, without any network
+// requests being made.
+var offline bool
+
+// The validators stored alongside a cached list, used to make conditional
+// requests when the list is next downloaded.
+type cacheMetadata struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// The SetCacheDir function sets the directory in which downloaded lists are
+// cached. When a cached copy of a list exists, a conditional request is made
+// using its ETag or Last-Modified validators and the cached copy is used if
+// the list has not changed. An empty directory disables caching.
+func SetCacheDir(dir string) {
+	cacheDir = dir
+}
+
+// The SetOffline function selects whether to use only the cached copies of
+// downloaded lists. When offline, no network requests are made and lists that
+// have not been cached cannot be used.
+func SetOffline(o bool) {
+	offline = o
+}
+
+// Returns the paths of the cached copy of a URL and of its metadata.
+func cachePaths(url string) (string, string) {
+	sum := sha256.Sum256([]byte(url))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(cacheDir, name), filepath.Join(cacheDir, name+".json")
+}
+
+// Reads the cached copy of a URL and its metadata, returning an error if the
+// URL has not been cached.
+func readCache(url string) ([]byte, *cacheMetadata, error) {
+	if cacheDir == "" {
+		return nil, nil, fmt.Errorf("no cache directory set for <%s>", url)
+	}
+	bodyPath, metadataPath := cachePaths(url)
+
+	metadataJSON, err := os.ReadFile(metadataPath)
+	if os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("<%s> has not been cached", url)
+	} else if err != nil {
+		return nil, nil, err
+	}
+	metadata := new(cacheMetadata)
+	err = json.Unmarshal(metadataJSON, metadata)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body, err := os.ReadFile(bodyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return body, metadata, nil
+}
+
+// Stores a downloaded copy of a URL and its metadata in the cache. The files
+// are written under temporary names and renamed into place so that an
+// interrupted write does not leave a corrupt cache entry.
+func writeCache(body []byte, metadata *cacheMetadata) error {
+	if cacheDir == "" {
+		return nil
+	}
+	err := os.MkdirAll(cacheDir, 0755)
+	if err != nil {
+		return err
+	}
+	bodyPath, metadataPath := cachePaths(metadata.URL)
+
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(bodyPath+".tmp", body, 0644)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(metadataPath+".tmp", metadataJSON, 0644)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(bodyPath+".tmp", bodyPath)
+	if err != nil {
+		return err
+	}
+	return os.Rename(metadataPath+".tmp", metadataPath)
+}
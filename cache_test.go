@@ -0,0 +1,147 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// A stand-in server for a list that changes, recording the validators sent
+// with each request.
+type listServer struct {
+	*httptest.Server
+	body         string
+	etag         string
+	lastModified string
+	requests     []http.Header
+}
+
+func newListServer(t *testing.T) *listServer {
+	s := new(listServer)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests = append(s.requests, r.Header.Clone())
+		if s.etag != "" {
+			w.Header().Set("ETag", s.etag)
+		}
+		if s.lastModified != "" {
+			w.Header().Set("Last-Modified", s.lastModified)
+		}
+		if s.etag != "" && r.Header.Get("If-None-Match") == s.etag ||
+			s.etag == "" && s.lastModified != "" && r.Header.Get("If-Modified-Since") == s.lastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		io.WriteString(w, s.body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Downloads a URL and returns the body, failing the test on an error.
+func downloadList(t *testing.T, url string) string {
+	reader, err := getReaderFromUrl(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(reader)
+	return string(body)
+}
+
+func TestCacheConditionalRequests(t *testing.T) {
+	resetSources(t)
+	SetCacheDir(t.TempDir())
+	s := newListServer(t)
+	s.body, s.etag, s.lastModified = "first", `"v1"`, "Wed, 01 Jan 2020 00:00:00 GMT"
+
+	if body := downloadList(t, s.URL); body != "first" {
+		t.Errorf("first request: got %q, want \"first\"", body)
+	}
+	if h := s.requests[0]; h.Get("If-None-Match") != "" || h.Get("If-Modified-Since") != "" {
+		t.Errorf("first request: sent validators %v", h)
+	}
+
+	// Not modified, so the cached copy is used
+	s.body = "not sent"
+	if body := downloadList(t, s.URL); body != "first" {
+		t.Errorf("not modified: got %q, want the cached \"first\"", body)
+	}
+	if h := s.requests[1]; h.Get("If-None-Match") != `"v1"` || h.Get("If-Modified-Since") != s.lastModified {
+		t.Errorf("not modified: sent If-None-Match %q and If-Modified-Since %q",
+			h.Get("If-None-Match"), h.Get("If-Modified-Since"))
+	}
+
+	// Modified, so the new copy is used and replaces the cached copy
+	s.body, s.etag = "second", `"v2"`
+	if body := downloadList(t, s.URL); body != "second" {
+		t.Errorf("modified: got %q, want \"second\"", body)
+	}
+	s.body = "not sent"
+	if body := downloadList(t, s.URL); body != "second" {
+		t.Errorf("after modification: got %q, want the cached \"second\"", body)
+	}
+	if h := s.requests[3]; h.Get("If-None-Match") != `"v2"` {
+		t.Errorf("after modification: sent If-None-Match %q, want \"v2\"", h.Get("If-None-Match"))
+	}
+}
+
+func TestCacheLastModifiedOnly(t *testing.T) {
+	resetSources(t)
+	SetCacheDir(t.TempDir())
+	s := newListServer(t)
+	s.body, s.lastModified = "first", "Wed, 01 Jan 2020 00:00:00 GMT"
+
+	downloadList(t, s.URL)
+	s.body = "not sent"
+	if body := downloadList(t, s.URL); body != "first" {
+		t.Errorf("got %q, want the cached \"first\"", body)
+	}
+	if h := s.requests[1]; h.Get("If-None-Match") != "" || h.Get("If-Modified-Since") != s.lastModified {
+		t.Errorf("sent If-None-Match %q and If-Modified-Since %q", h.Get("If-None-Match"), h.Get("If-Modified-Since"))
+	}
+}
+
+func TestCacheDisabled(t *testing.T) {
+	resetSources(t)
+	s := newListServer(t)
+	s.body, s.etag = "first", `"v1"`
+
+	downloadList(t, s.URL)
+	s.body = "second"
+	if body := downloadList(t, s.URL); body != "second" {
+		t.Errorf("got %q, want \"second\"", body)
+	}
+	if h := s.requests[1]; h.Get("If-None-Match") != "" {
+		t.Errorf("sent If-None-Match %q without a cache", h.Get("If-None-Match"))
+	}
+}
+
+func TestCacheOffline(t *testing.T) {
+	resetSources(t)
+	SetCacheDir(t.TempDir())
+	s := newListServer(t)
+	s.body, s.etag = "first", `"v1"`
+	downloadList(t, s.URL)
+
+	SetOffline(true)
+	s.body = "second"
+	if body := downloadList(t, s.URL); body != "first" {
+		t.Errorf("cached: got %q, want the cached \"first\"", body)
+	}
+	_, err := getReaderFromUrl(s.URL + "/uncached")
+	want := "offline: <" + s.URL + "/uncached> has not been cached"
+	if err == nil || err.Error() != want {
+		t.Errorf("not cached: got error %v, want %q", err, want)
+	}
+	if len(s.requests) != 1 {
+		t.Errorf("made %d requests while offline", len(s.requests)-1)
+	}
+
+	// Without a cache directory, nothing can be used offline
+	SetCacheDir("")
+	_, err = getReaderFromUrl(s.URL)
+	if err == nil || !strings.HasPrefix(err.Error(), "offline: ") {
+		t.Errorf("no cache directory: got error %v, want an offline error", err)
+	}
+}
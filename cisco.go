@@ -1,8 +1,8 @@
 package hellfire // import "pathspider.net/hellfire"
 
 import (
-	"archive/zip"
-	"log"
+	"context"
+	"fmt"
 )
 
 type CiscoUmbrellaList struct {
@@ -13,39 +13,43 @@ type CiscoUmbrellaList struct {
 // URL to download the latest Cisco Umbrella list from
 const CiscoUmbrellaURL string = "http://s3-us-west-1.amazonaws.com/umbrella-static/top-1m.csv.zip"
 
+func init() {
+	RegisterSource(Source{
+		Name: "cisco",
+		New: func(options map[string]string) (TestList, error) {
+			l := new(CiscoUmbrellaList)
+			l.SetFilename(options[FileOption])
+			return l, nil
+		},
+	})
+}
+
 func (l *CiscoUmbrellaList) SetFilename(filename string) {
 	l.filename = filename
 }
 
 func (l *CiscoUmbrellaList) FeedJobs(jobs chan map[string]interface{}) {
+	feedJobs(l, jobs)
+}
+
+func (l *CiscoUmbrellaList) Feed(ctx context.Context, jobs chan map[string]interface{}) error {
 	var topsites *CSVList
 
 	if l.filename == "" {
-		urlReader, err := getReaderFromUrl(CiscoUmbrellaURL)
+		urlReader, source, err := getReaderFromSource("cisco")
 		if err != nil {
-			log.Fatalf("Unable to get <%s>: %s", CiscoUmbrellaURL, err)
+			return fmt.Errorf("unable to get <%s>: %s", source, err)
 		}
 
-		zr, err := zip.NewReader(urlReader, int64(urlReader.Len()))
+		topsites = CSVListFromReader(urlReader)
+	} else {
+		var err error
+		topsites, err = OpenCSVList(l.filename)
 		if err != nil {
-			log.Fatalf("Unable to read zip: %s", err)
+			return err
 		}
-
-		for _, zf := range zr.File {
-			if zf.Name == "top-1m.csv" {
-				f, _ := zf.Open()
-				topsites = CSVListFromReader(f)
-				break
-			}
-		}
-
-		if topsites == nil {
-			panic("Did not find top-1m.csv in the zip archive")
-		}
-	} else {
-		topsites = CSVListFromFile(l.filename)
 	}
 
 	topsites.SetHeader([]string{"rank", "domain"})
-	topsites.FeedJobs(jobs)
+	return topsites.Feed(ctx, jobs)
 }
@@ -1,21 +1,55 @@
 package hellfire // import "pathspider.net/hellfire"
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"strings"
 )
 
 type CitizenLabCountryList struct {
 	TestList
-	country  string
-	filename string
+	gitSource
+	countries  []string
+	categories map[string]bool
+	filename   string
 }
 
-// URL format string to download the latest Citizen Lab test list from. The %s
+// URL format string to download a Citizen Lab test list from. The first %s
+// will be replaced with the revision of the repository, which is "master"
+// unless the list has been pinned with SetRevision or SetDate. The second %s
 // will be replaced with either the two letter country code, or with "global"
 // as specified in the call to SetCountry before the job feeder is activated.
-const CitizenLabCountryListURL string = "https://raw.githubusercontent.com/citizenlab/test-lists/master/lists/%s.csv"
+const CitizenLabCountryListURL string = "https://raw.githubusercontent.com/citizenlab/test-lists/%s/lists/%s.csv"
+
+// GitHub repository and branch holding the Citizen Lab test lists
+const (
+	CitizenLabRepository string = "citizenlab/test-lists"
+	CitizenLabBranch     string = "master"
+)
+
+func init() {
+	RegisterSource(Source{
+		Name:    "citizenlab",
+		Options: append([]string{"country", "category"}, revisionOptions...),
+		Variant: "country",
+		New: func(options map[string]string) (TestList, error) {
+			l := new(CitizenLabCountryList)
+			if options["country"] != "" {
+				l.SetCountries(strings.Split(options["country"], ","))
+			} else {
+				l.SetCountry("global")
+			}
+			if options["category"] != "" {
+				l.SetCategories(strings.Split(options["category"], ","))
+			}
+			setRevisionOptions(l, options)
+			l.SetFilename(options[FileOption])
+			return l, nil
+		},
+	})
+}
 
 func (l *CitizenLabCountryList) SetFilename(filename string) {
 	l.filename = filename
@@ -28,35 +62,91 @@ func (l *CitizenLabCountryList) SetFilename(filename string) {
 //
 // This function must be called before FeedJobs() or the application will panic.
 func (l *CitizenLabCountryList) SetCountry(country string) {
-	country = strings.ToLower(country)
-	if country == "global" || len(country) == 2 {
-		l.country = country
-	} else {
-		panic("Country code must be two characters, or 'global'.")
+	l.SetCountries([]string{country})
+}
+
+// The SetCountries method allows selection of several Citizen Lab test lists
+// to be used together, in the same way as SetCountry. The jobs from each list
+// are submitted in turn, and "global" may be included to also use the global
+// test list.
+func (l *CitizenLabCountryList) SetCountries(countries []string) {
+	l.countries = nil
+	for _, country := range countries {
+		country = strings.ToLower(strings.TrimSpace(country))
+		if country == "global" || len(country) == 2 {
+			l.countries = append(l.countries, country)
+		} else {
+			panic("Country code must be two characters, or 'global'.")
+		}
+	}
+}
+
+// The SetCategories method selects only the entries of the test lists with
+// one of the given category codes (e.g. "NEWS", "HUMR" or "ANON"). All
+// entries are used if no categories are set.
+func (l *CitizenLabCountryList) SetCategories(categories []string) {
+	l.categories = make(map[string]bool)
+	for _, category := range categories {
+		l.categories[strings.ToUpper(strings.TrimSpace(category))] = true
 	}
 }
 
 func (l *CitizenLabCountryList) FeedJobs(jobs chan map[string]interface{}) {
-	var citizenLabList *CSVList
+	feedJobs(l, jobs)
+}
 
+// The Feed method submits a job for each entry in the selected test lists.
+// The country of the list that each entry came from is recorded in the
+// "citizenlab_country" field of the job, and the revision of the repository
+// it was read from in the "citizenlab_revision" field.
+func (l *CitizenLabCountryList) Feed(ctx context.Context, jobs chan map[string]interface{}) error {
 	if l.filename == "" {
-		if l.country == "" {
-			panic("The country to use for the Citizen Lab test was not specified")
+		if len(l.countries) == 0 {
+			return errors.New("the country to use for the Citizen Lab test was not specified")
 		}
-		listUrl := fmt.Sprintf(CitizenLabCountryListURL, l.country)
-		urlReader, err := getReaderFromUrl(listUrl)
-		if err != nil {
-			log.Fatalf("Unable to get <%s>: %s", listUrl, err)
+		for _, country := range l.countries {
+			listPath := fmt.Sprintf("lists/%s.csv", country)
+			urlReader, source, revision, err := l.getReader(CitizenLabRepository,
+				CitizenLabBranch, listPath, func(revision string) (*bytes.Reader, string, error) {
+					return getReaderFromSource("citizenlab", revision, country)
+				})
+			if err != nil {
+				return fmt.Errorf("unable to get <%s>: %s", source, err)
+			}
+
+			err = l.feedCountry(ctx, country, revision, CSVListFromReader(urlReader), jobs)
+			if err != nil {
+				return err
+			}
 		}
+		return nil
+	}
 
-		citizenLabList = CSVListFromReader(urlReader)
-	} else {
-		// Note that country codes starting with X are "private use"
-		// and XF in this case is to indicate that a file was used.
-		// BUG(irl): Maybe a hint could be provided on the command line
-		// later.
-		l.SetCountry("xf")
-		citizenLabList = CSVListFromFile(l.filename)
+	// Note that country codes starting with X are "private use"
+	// and XF in this case is to indicate that a file was used.
+	// BUG(irl): Maybe a hint could be provided on the command line
+	// later.
+	l.SetCountry("xf")
+	citizenLabList, err := OpenCSVList(l.filename)
+	if err != nil {
+		return err
 	}
-	citizenLabList.FeedJobs(jobs)
+	return l.feedCountry(ctx, "xf", "", citizenLabList, jobs)
+}
+
+func (l *CitizenLabCountryList) feedCountry(ctx context.Context, country string, revision string,
+	citizenLabList *CSVList, jobs chan map[string]interface{}) error {
+	return feedThrough(ctx, citizenLabList, func(job map[string]interface{}) error {
+		if len(l.categories) > 0 {
+			category, _ := job["category_code"].(string)
+			if !l.categories[strings.ToUpper(category)] {
+				return nil
+			}
+		}
+		job["citizenlab_country"] = country
+		if revision != "" {
+			job["citizenlab_revision"] = revision
+		}
+		return sendJob(ctx, jobs, job)
+	})
 }
@@ -6,16 +6,117 @@
 // BASIC USAGE
 //
 //  Usage:
-//    hellfire --topsites [--file=<filename>] [--output=<individual|array|oneeach>] [--type=<host|ns|mx>] [--canid=<canid address>] [--rate=<qps>]
-//    hellfire --cisco [--file=<filename>] [--output=<individual|array|oneeach>] [--type=<host|ns|mx>] [--canid=<canid address>] [--rate=<qps>]
-//    hellfire --citizenlab [--country=<cc>|--file=<filename>] [--output=<individual|array|oneeach>] [--type=<host|ns|mx>] [--canid=<canid address>] [--rate=<qps>]
-//    hellfire --opendns [--list=<name>|--file=<filename>] [--output=<individual|array|oneeach>] [--type=<host|ns|mx>] [--canid=<canid address>] [--rate=<qps>]
-//    hellfire --csv --file=<filename> [--output=<individual|array|oneeach>] [--type=<host|ns|mx>] [--canid=<canid address>] [--rate=<qps>]
-//    hellfire --txt --file=<filename> [--output=<individual|array|oneeach>] [--type=<host|ns|mx>] [--canid=<canid address>] [--rate=<qps>]
+//    hellfire --topsites [--file=<filename>] [--meta=<key=value>...] [options]
+//    hellfire --cisco [--file=<filename>] [--meta=<key=value>...] [options]
+//    hellfire --tranco [--list-id=<id>] [--file=<filename>] [--meta=<key=value>...] [options]
+//    hellfire --majestic [--file=<filename>] [--meta=<key=value>...] [options]
+//    hellfire --crux [--file=<filename>] [--meta=<key=value>...] [options]
+//    hellfire --citizenlab [--country=<cc>|--file=<filename>] [--category=<codes>] [--meta=<key=value>...] [options]
+//    hellfire --opendns [--list=<name>|--file=<filename>] [--meta=<key=value>...] [options]
+//    hellfire --csv --file=<filename> [--meta=<key=value>...] [options]
+//    hellfire --txt --file=<filename> [--meta=<key=value>...] [options]
+//    hellfire --json --file=<filename> [--meta=<key=value>...] [options]
+//    hellfire --pcap --file=<filename> [--meta=<key=value>...] [options]
+//    hellfire --source=<spec>... [--combine=<union|intersection>] [--list-id=<id>] [--category=<codes>] [--meta=<key=value>...] [options]
 //
 //  Options:
-//    -h --help     Show this screen.
-//    --version     Show version.
+//    -h --help                             Show this screen.
+//    --version                             Show version.
+//    --output=<individual|array|oneeach>   Output type [default: individual].
+//    --type=<host|ns|mx>                   Lookup type [default: host].
+//    --family=<4|6|both>                   Address family [default: both].
+//    --canid=<canid address>               Address of Canid for additional info.
+//    --rate=<qps>                          Queries per second [default: 10].
+//    --bogons                              Filter special-purpose addresses.
+//    --deny=<filename>                     Filter addresses in listed CIDRs.
+//    --filter-action=<drop|flag>           Action for filtered addresses
+//                                          [default: drop].
+//    --sinkholes                           Flag known sinkhole addresses.
+//    --sinkhole-file=<filename>            Flag sinkhole addresses listed in file.
+//    --wildcards                           Flag addresses given by wildcard records.
+//    --expand=<filename>                   Also look up names with labels from file.
+//    --cache-dir=<dir>                     Directory to cache downloaded lists in.
+//    --offline                             Use only cached copies of lists.
+//    --limit=<n>                           Look up at most n names from the list.
+//    --rank-range=<a-b>                    Look up only names ranked from a to b.
+//    --sample=<n>                          Look up a random sample of n names.
+//    --sample-fraction=<f>                 Look up a random fraction f of names.
+//    --seed=<seed>                         Seed for random sampling.
+//    --list-id=<id>                        Tranco list ID to use.
+//    --category=<codes>                    Citizen Lab categories to select.
+//    --revision=<rev>                      Git revision of the list to use.
+//    --date=<YYYY-MM-DD>                   Use the list as it was on a date.
+//    --checkout=<path>                     Read the list from a local git clone.
+//    --mirrors=<spec>                      Override source URLs with mirrors.
+//    --mirrors-file=<filename>             Override source URLs from a file.
+//    --domain-column=<col>                 CSV column holding the domain.
+//    --url-column=<col>                    CSV column holding a URL.
+//    --delimiter=<char>                    CSV field delimiter, e.g. "tab".
+//    --comment=<char>                      CSV comment character.
+//    --skip-rows=<n>                       Skip n lines at the start of the CSV.
+//    --no-header                           The CSV has no header row.
+//    --lenient                             Accept CSV rows with missing fields.
+//    --meta=<key=value>                    Add a field to every record.
+//    --meta-file=<filename>                Add the fields of a JSON object to every
+//                                          record.
+//    --dedup                               Look up each domain once, merging records.
+//    --psl                                 Add registrable domains and public suffixes.
+//    --psl-file=<filename>                 Public Suffix List to use in place of the
+//                                          embedded copy.
+//    --one-per-site                        Look up one name per registrable domain.
+//
+// INPUT FORMATS
+//
+// The --tranco source uses the latest Tranco list unless a list ID is given
+// with --list-id. The ID of the list used is recorded in each record so that
+// runs are reproducible and citable.
+//
+// The --crux source uses the global Chrome UX Report top origins list, where
+// the rank is the popularity bucket of the origin rather than an exact rank.
+//
+// The --json source reads jobs from either NDJSON, with one JSON object per
+// line, or from a JSON array of objects. Each object must have a "domain" or
+// "url" field, and all other fields are passed through to the output.
+//
+// The --citizenlab source accepts a comma-separated list of countries, which
+// may include "global", for example "--country=ir,cn,global". Entries can be
+// selected by category with a comma-separated list of category codes, for
+// example "--category=NEWS,HUMR,ANON". The country of the list that each entry
+// came from is recorded in a "citizenlab_country" field.
+//
+// The --csv source reads a header row naming the fields of each job, which
+// must include a "domain" or "url" field. Other columns can be selected with
+// --domain-column or --url-column, either by name or by position counting from
+// 1. With --no-header, the fields are named "column1", "column2" and so on,
+// and the domain is taken from the first column by default. The delimiter can
+// be set with --delimiter, e.g. "--delimiter=tab" for TSV, and rows starting
+// with the character given with --comment are ignored. Any preamble before the
+// header can be skipped with --skip-rows. Rows must all have the same number
+// of fields unless --lenient is given, in which case missing fields are left
+// out and rows without the domain or URL column are skipped.
+//
+// The --txt source reads one entry per line, which may be a domain, a URL, or
+// a host and port given as "host:port" or "[address]:port". Blank lines are
+// ignored, as is anything following a "#" at the start of a line or after
+// whitespace. A port given in an entry is recorded in a "port" field.
+//
+// The --pcap source reads a packet capture in pcap or pcapng format and takes
+// names from DNS questions, the Server Name Indication of TLS ClientHellos and
+// the Host header of HTTP requests. Each name is looked up once, and the
+// protocol it was first seen in is recorded in a "hellfire_pcap_protocol"
+// field, along with the destination port in a "port" field for TLS and HTTP.
+// TCP streams are not reassembled, so only ClientHellos and requests that
+// start a segment are found.
+//
+// Domain names from every source are normalised to lowercase A-labels, with
+// whitespace and any trailing dot removed. For internationalised domain names
+// given in Unicode, the name as given is kept in a "hellfire_unicode_domain"
+// field. Names that are not valid domain names are logged with the reason and
+// are not looked up. Labels may contain underscores and hyphens in any
+// position, as in _dmarc.example.com, as such names are found in DNS.
+//
+// For any source read from a file, the filename "-" may be given to read from
+// standard input instead, allowing hellfire to be used in a pipeline.
 //
 // OUTPUT TYPES
 //
@@ -26,16 +127,171 @@
 // * "oneeach" - One record output per IP address, only printing one IPv4 and
 // one IPv6 at most for each domain.
 //
+// ADDRESS FAMILIES
+//
+// By default both A and AAAA records are looked up. The --family option can
+// be set to "4" or "6" to query only for A or AAAA records respectively. Every
+// record output has a "family" field set to either 4 or 6.
+//
+// ADDRESS FILTERING
+//
+// The --bogons option filters addresses in the IANA special-purpose ranges,
+// such as private, loopback, link-local, CGNAT, documentation and multicast
+// addresses. The --deny option filters addresses in the ranges listed in a
+// file, one CIDR per line. Filtered addresses are dropped by default, or with
+// --filter-action=flag are output with a "hellfire_filtered" field giving the
+// reason.
+//
+// SINKHOLE DETECTION
+//
+// The --sinkholes option flags addresses that are known sinkhole or
+// censorship blockpage addresses, and --sinkhole-file adds further addresses
+// or CIDRs from a file, one per line with an optional label. Matching records
+// are output with a "hellfire_sinkhole" field giving the label. Known
+// sinkholes are always flagged for the Citizen Lab test lists. Known
+// censorship blockpages are also given a "hellfire_blockpage" field and are
+// never dropped by --bogons or --deny, as some blockpages are at private
+// addresses, but are flagged in "hellfire_filtered" instead. Other sinkholes,
+// such as null-route answers of 127.0.0.1, are dropped as usual.
+//
+// WILDCARD DETECTION
+//
+// The --wildcards option looks up random non-existent labels under the
+// registrable domain of each name, and flags records whose address matches
+// one returned for those labels with a "hellfire_wildcard" field. The probes
+// use the address family given with --family and count towards --rate, and
+// are only made for --type=host.
+//
+// SUBDOMAIN EXPANSION
+//
+// The --expand option reads a list of labels from a file, one per line, and
+// looks up each input domain prefixed with each of the labels as well as the
+// domain itself. Records for expanded names have a "hellfire_expanded_from"
+// field with the original domain and a "hellfire_expansion_label" field with
+// the label used.
+//
+// SOURCE URLS AND MIRRORS
+//
+// The URL that each source is downloaded from can be overridden by an ordered
+// list of mirrors, which are tried in turn until a download succeeds. The
+// sources are named topsites, cisco, tranco, tranco-id, majestic, crux,
+// citizenlab, opendns and github-commits. Mirrors can be set:
+//
+// * in environment variables of the form HELLFIRE_<NAME>_URL, e.g.
+// HELLFIRE_CISCO_URL, holding a whitespace separated list of URLs;
+// * in a file given with --mirrors-file, where each line holds a source name
+// followed by a whitespace separated list of URLs;
+// * with --mirrors, as a whitespace separated list of entries of the form
+// "name=url[,url...]".
+//
+// These are applied in that order, with later settings replacing earlier ones
+// for the same source. URLs for the citizenlab, opendns, tranco and
+// github-commits sources are format strings taking the same arguments as the
+// default URLs.
+//
+// DOWNLOAD CACHE
+//
+// Downloaded lists are cached, by default in a "hellfire" directory within the
+// user's cache directory, or in the directory given with --cache-dir. Cached
+// lists are revalidated with conditional requests and only downloaded again
+// if they have changed. With --offline, only the cached copies are used and no
+// requests are made.
+//
+// LIST REVISIONS
+//
+// The Citizen Lab and OpenDNS lists are held in git repositories, and the
+// latest revision is used by default. The --revision option pins the list to
+// a commit, tag or branch, and --date pins it to the last revision on or
+// before a date, so that historical measurements can be regenerated with the
+// exact list that existed at the time. Dates are taken to be in UTC. With
+// --checkout, the list is read from a local clone of the repository instead of
+// being downloaded. The revision used is recorded in a "citizenlab_revision"
+// or "opendns_revision" field, as a commit hash when pinned with --date or
+// read from a local clone, and as given otherwise. When the working tree of a
+// clone is read, the commit checked out is recorded, with "-dirty" appended
+// if the list differs from that commit.
+//
+// COMBINING LISTS
+//
+// Several lists can be used in one run by giving --source once for each list,
+// where the spec has the form "name[:variant[:filename]]" with the name being
+// one of topsites, cisco, tranco, majestic, crux, citizenlab, opendns, csv,
+// txt, json or pcap. For example, "--source=cisco --source=citizenlab:ir"
+// combines the Cisco Umbrella list with the Citizen Lab test list for Iran.
+// The variant is the country for citizenlab, the list name for opendns and the
+// list ID for tranco, and may be left empty to give only a filename, as in
+// "citizenlab::ir.csv". The other sources have no variant, so the filename
+// follows the name directly, as in "txt:names.txt" or "csv:list.csv".
+// The lists are combined as a union by default, or as an intersection with
+// --combine=intersection. Each record has a "hellfire_sources" field listing
+// the lists, and ranks within them, that contributed its domain.
+//
+// Options for the sources, such as --revision or --delimiter, apply to every
+// list whose source accepts them, with the variant and filename given in a
+// spec taking precedence. It is an error to give an option that none of the
+// sources accept.
+//
+// Any source registered with hellfire.RegisterSource, including those
+// registered by other packages built into the command, can be selected with
+// --source.
+//
+// INPUT SHAPING
+//
+// Part of a list can be selected with --rank-range, which uses the "rank"
+// field of lists that have one (e.g. "--rank-range=100000-1000000"), and with
+// --sample or --sample-fraction, which select names at random. Sampling is
+// reproducible when the same --seed is given; otherwise the seed used is
+// logged. Finally, --limit caps the number of names looked up. These are
+// applied in that order, so that "--rank-range=100000-1000000 --sample=5000"
+// selects a random 5000 names from those ranks. Shaping selects names from the
+// input list before any are added by --expand.
+//
+// DEDUPLICATION
+//
+// With --dedup, each domain is looked up once however many times it appears
+// in the input, as happens where many URLs in a list share a host. The fields
+// of all the records for a domain are merged, with any field whose values
+// differ holding a list of the distinct values, except that "rank" holds the
+// best rank and the distinct ranks are listed in a "hellfire_ranks" field. The
+// number of records merged is given in a "hellfire_input_rows" field. As the
+// whole input must be read first, lookups only start once the list has been
+// read.
+//
+// PUBLIC SUFFIXES
+//
+// The --psl option adds the registrable domain (eTLD+1) and public suffix of
+// each name to its record, in "hellfire_registrable_domain" and
+// "hellfire_public_suffix" fields. A copy of the Public Suffix List is built
+// into hellfire, and another copy can be used with --psl-file. With
+// --one-per-site, only the first name from the input for each registrable
+// domain is looked up, so that a single target is measured for each site.
+// These are applied after --dedup and before the input shaping options and
+// --expand.
+//
+// METADATA
+//
+// Fields can be added to every record, for example to tag a run with a
+// campaign identifier, with --meta as "--meta=campaign=2026-10", which may be
+// given more than once. The fields of a JSON object in a file given with
+// --meta-file are also added, with --meta taking precedence for the same
+// field. Fields that a record already has from the input list are not
+// replaced.
+//
 // SEE ALSO
 //
 // The PATHspider website can be found at https://pathspider.net/.
 package main
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
 	"strconv"
+	"time"
 
 	docopt "github.com/docopt/docopt-go"
 	"pathspider.net/hellfire"
@@ -49,49 +305,89 @@ PATHspider measurements. For sources where the filename is optional, the latest
 source will be downloaded from the Internet when the filename is omitted.
 
 Usage:
-  hellfire --topsites [--file=<filename>] [--output=<individual|array|oneeach>] [--type=<host|ns|mx>] [--canid=<canid address>] [--rate=<qps>]
-  hellfire --cisco [--file=<filename>] [--output=<individual|array|oneeach>] [--type=<host|ns|mx>] [--canid=<canid address>] [--rate=<qps>]
-  hellfire --citizenlab [--country=<cc>|--file=<filename>] [--output=<individual|array|oneeach>] [--type=<host|ns|mx>] [--canid=<canid address>] [--rate=<qps>]
-  hellfire --opendns [--list=<name>|--file=<filename>] [--output=<individual|array|oneeach>] [--type=<host|ns|mx>] [--canid=<canid address>] [--rate=<qps>]
-  hellfire --csv --file=<filename> [--output=<individual|array|oneeach>] [--type=<host|ns|mx>] [--canid=<canid address>] [--rate=<qps>]
-  hellfire --txt --file=<filename> [--output=<individual|array|oneeach>] [--type=<host|ns|mx>] [--canid=<canid address>] [--rate=<qps>]
+  hellfire --topsites [--file=<filename>] [--meta=<key=value>...] [options]
+  hellfire --cisco [--file=<filename>] [--meta=<key=value>...] [options]
+  hellfire --tranco [--list-id=<id>] [--file=<filename>] [--meta=<key=value>...] [options]
+  hellfire --majestic [--file=<filename>] [--meta=<key=value>...] [options]
+  hellfire --crux [--file=<filename>] [--meta=<key=value>...] [options]
+  hellfire --citizenlab [--country=<cc>|--file=<filename>] [--category=<codes>] [--meta=<key=value>...] [options]
+  hellfire --opendns [--list=<name>|--file=<filename>] [--meta=<key=value>...] [options]
+  hellfire --csv --file=<filename> [--meta=<key=value>...] [options]
+  hellfire --txt --file=<filename> [--meta=<key=value>...] [options]
+  hellfire --json --file=<filename> [--meta=<key=value>...] [options]
+  hellfire --pcap --file=<filename> [--meta=<key=value>...] [options]
+  hellfire --source=<spec>... [--combine=<union|intersection>] [--list-id=<id>] [--category=<codes>] [--meta=<key=value>...] [options]
 
 Options:
-  -h --help                           Show this screen.
-  --version                           Show version.`
+  -h --help                             Show this screen.
+  --version                             Show version.
+  --output=<individual|array|oneeach>   Output type [default: individual].
+  --type=<host|ns|mx>                   Lookup type [default: host].
+  --family=<4|6|both>                   Address family [default: both].
+  --canid=<canid address>               Address of Canid for additional info.
+  --rate=<qps>                          Queries per second [default: 10].
+  --bogons                              Filter special-purpose addresses.
+  --deny=<filename>                     Filter addresses in listed CIDRs.
+  --filter-action=<drop|flag>           Action for filtered addresses
+                                        [default: drop].
+  --sinkholes                           Flag known sinkhole addresses.
+  --sinkhole-file=<filename>            Flag sinkhole addresses listed in file.
+  --wildcards                           Flag addresses given by wildcard records.
+  --expand=<filename>                   Also look up names with labels from file.
+  --cache-dir=<dir>                     Directory to cache downloaded lists in.
+  --offline                             Use only cached copies of lists.
+  --limit=<n>                           Look up at most n names from the list.
+  --rank-range=<a-b>                    Look up only names ranked from a to b.
+  --sample=<n>                          Look up a random sample of n names.
+  --sample-fraction=<f>                 Look up a random fraction f of names.
+  --seed=<seed>                         Seed for random sampling.
+  --list-id=<id>                        Tranco list ID to use.
+  --category=<codes>                    Citizen Lab categories to select.
+  --revision=<rev>                      Git revision of the list to use.
+  --date=<YYYY-MM-DD>                   Use the list as it was on a date.
+  --checkout=<path>                     Read the list from a local git clone.
+  --mirrors=<spec>                      Override source URLs with mirrors.
+  --mirrors-file=<filename>             Override source URLs from a file.
+  --domain-column=<col>                 CSV column holding the domain.
+  --url-column=<col>                    CSV column holding a URL.
+  --delimiter=<char>                    CSV field delimiter, e.g. "tab".
+  --comment=<char>                      CSV comment character.
+  --skip-rows=<n>                       Skip n lines at the start of the CSV.
+  --no-header                           The CSV has no header row.
+  --lenient                             Accept CSV rows with missing fields.
+  --meta=<key=value>                    Add a field to every record.
+  --meta-file=<filename>                Add the fields of a JSON object to every
+                                        record.
+  --dedup                               Look up each domain once, merging records.
+  --psl                                 Add registrable domains and public suffixes.
+  --psl-file=<filename>                 Public Suffix List to use in place of the
+                                        embedded copy.
+  --one-per-site                        Look up one name per registrable domain.`
 
 	arguments, _ := docopt.Parse(usage, nil, true, "Hellfire dev", false)
 
 	var listName string
-	var listVariant string
-	var listFilename string
-
-	if arguments["--topsites"].(bool) {
-		listName = "topsites"
-	} else if arguments["--cisco"].(bool) {
-		listName = "cisco"
-	} else if arguments["--citizenlab"].(bool) {
-		listName = "citizenlab"
-		if arguments["--country"] != nil {
-			listVariant = arguments["--country"].(string)
-		} else {
-			listVariant = "global"
+	for _, name := range hellfire.Sources() {
+		if selected, _ := arguments["--"+name].(bool); selected {
+			listName = name
 		}
-	} else if arguments["--opendns"].(bool) {
-		listName = "opendns"
-		if arguments["--list"] != nil {
-			listVariant = arguments["--list"].(string)
-		} else {
-			listVariant = "top"
-		}
-	} else if arguments["--csv"].(bool) {
-		listName = "csv"
-	} else if arguments["--txt"].(bool) {
-		listName = "txt"
 	}
 
-	if arguments["--file"] != nil {
-		listFilename = arguments["--file"].(string)
+	// Options for sources are given by the command line options of the
+	// same name, and the source will reject any that it does not accept.
+	listOptions := make(map[string]string)
+	for _, name := range hellfire.Sources() {
+		source, _ := hellfire.LookupSource(name)
+		for _, option := range append(source.Options, hellfire.FileOption) {
+			switch value := arguments["--"+option].(type) {
+			case string:
+				listOptions[option] = value
+			case bool:
+				if value {
+					listOptions[option] = "true"
+				}
+			}
+		}
 	}
 
 	var queriesPerSecond = 10
@@ -121,6 +417,22 @@ Options:
 		lookupType = "host"
 	}
 
+	var family string
+	supportedFamilies := []string{"4", "6", "both"}
+	if arguments["--family"] != nil {
+		for _, supportedFamily := range supportedFamilies {
+			if arguments["--family"].(string) == supportedFamily {
+				family = arguments["--family"].(string)
+			}
+		}
+		if family == "" {
+			panic("Unsupported address family requested.")
+			//BUG(irl): Should list the supported families.
+		}
+	} else {
+		family = "both"
+	}
+
 	var outputType string
 	supportedOutputTypes := []string{"individual", "array", "oneeach"}
 	if arguments["--output"] != nil {
@@ -144,6 +456,250 @@ Options:
 		canidAddress = arguments["--canid"].(string)
 	}
 
-	testListOptions := strings.Join([]string{listName, listVariant, listFilename}, ";")
-	hellfire.PerformLookups(testListOptions, lookupType, outputType, canidAddress, queriesPerSecond)
+	// Known sinkholes are always flagged for the Citizen Lab test lists,
+	// whether selected alone or with --source
+	citizenLab := listName == "citizenlab"
+	for _, source := range arguments["--source"].([]string) {
+		if strings.SplitN(source, ":", 2)[0] == "citizenlab" {
+			citizenLab = true
+		}
+	}
+
+	// The sinkhole list comes first so that the address filter can exempt
+	// known blockpages in special-purpose ranges from being dropped
+	var filters []hellfire.ResultFilter
+	if arguments["--sinkholes"].(bool) || arguments["--sinkhole-file"] != nil || citizenLab {
+		sinkholeList := new(hellfire.SinkholeList)
+		if arguments["--sinkholes"].(bool) || citizenLab {
+			sinkholeList.AddKnownSinkholes()
+		}
+		if arguments["--sinkhole-file"] != nil {
+			err := sinkholeList.LoadFile(arguments["--sinkhole-file"].(string))
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(2)
+			}
+		}
+		filters = append(filters, sinkholeList)
+	}
+	if arguments["--bogons"].(bool) || arguments["--deny"] != nil {
+		addressFilter := new(hellfire.AddressFilter)
+		if arguments["--bogons"].(bool) {
+			addressFilter.AddSpecialPurpose()
+		}
+		if arguments["--deny"] != nil {
+			err := addressFilter.LoadDenyList(arguments["--deny"].(string))
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(2)
+			}
+		}
+		switch arguments["--filter-action"].(string) {
+		case "drop":
+			addressFilter.SetFlag(false)
+		case "flag":
+			addressFilter.SetFlag(true)
+		default:
+			panic("Unsupported filter action requested.")
+		}
+		filters = append(filters, addressFilter)
+	}
+
+	if arguments["--wildcards"].(bool) {
+		filters = append(filters, new(hellfire.WildcardDetector))
+	}
+
+	hellfire.LoadSourceURLsFromEnv()
+	if arguments["--mirrors-file"] != nil {
+		err := hellfire.LoadSourceURLsFile(arguments["--mirrors-file"].(string))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+	}
+	if arguments["--mirrors"] != nil {
+		for _, mirror := range strings.Fields(arguments["--mirrors"].(string)) {
+			mirrorParts := strings.SplitN(mirror, "=", 2)
+			if len(mirrorParts) != 2 {
+				fmt.Println("Mirrors must be given in the form name=url[,url...].")
+				os.Exit(2)
+			}
+			err := hellfire.SetSourceURLs(mirrorParts[0], strings.Split(mirrorParts[1], ","))
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(2)
+			}
+		}
+	}
+
+	if arguments["--cache-dir"] != nil {
+		hellfire.SetCacheDir(arguments["--cache-dir"].(string))
+	} else if userCacheDir, err := os.UserCacheDir(); err == nil {
+		hellfire.SetCacheDir(filepath.Join(userCacheDir, "hellfire"))
+	}
+	hellfire.SetOffline(arguments["--offline"].(bool))
+
+	var testList hellfire.TestList
+	if sources := arguments["--source"].([]string); len(sources) > 0 {
+		// Each option applies to every list whose source accepts it, and
+		// must be accepted by at least one of them
+		for option := range listOptions {
+			accepted := false
+			for _, source := range sources {
+				name := strings.SplitN(source, ":", 2)[0]
+				if s, ok := hellfire.LookupSource(name); ok && s.Accepts(option) {
+					accepted = true
+				}
+			}
+			if !accepted {
+				fmt.Printf("None of the sources accept the --%s option\n", option)
+				os.Exit(2)
+			}
+		}
+		combinedList := new(hellfire.CombinedList)
+		for _, source := range sources {
+			sourceList, err := hellfire.NewTestListFromSpecWithOptions(source, listOptions)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(2)
+			}
+			combinedList.AddList(source, hellfire.NewDomainNormaliser(sourceList))
+		}
+		switch arguments["--combine"] {
+		case nil, "union":
+			combinedList.SetIntersection(false)
+		case "intersection":
+			combinedList.SetIntersection(true)
+		default:
+			panic("Unsupported combination requested.")
+		}
+		testList = combinedList
+	} else {
+		var err error
+		testList, err = hellfire.NewTestList(listName, listOptions)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		testList = hellfire.NewDomainNormaliser(testList)
+	}
+
+	if arguments["--dedup"].(bool) {
+		testList = hellfire.NewDomainDeduplicator(testList)
+	}
+
+	if arguments["--psl"].(bool) || arguments["--psl-file"] != nil || arguments["--one-per-site"].(bool) {
+		annotator := hellfire.NewPublicSuffixAnnotator(testList)
+		if arguments["--psl-file"] != nil {
+			list, err := hellfire.LoadPublicSuffixList(arguments["--psl-file"].(string))
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(2)
+			}
+			annotator.SetList(list)
+		}
+		annotator.SetDedup(arguments["--one-per-site"].(bool))
+		testList = annotator
+	}
+
+	if arguments["--limit"] != nil || arguments["--rank-range"] != nil ||
+		arguments["--sample"] != nil || arguments["--sample-fraction"] != nil {
+		shapedList := hellfire.NewShapedList(testList)
+		if arguments["--limit"] != nil {
+			limit, err := strconv.Atoi(arguments["--limit"].(string))
+			if err != nil || limit < 1 {
+				fmt.Println("Invalid limit, expected a positive number:", arguments["--limit"])
+				os.Exit(2)
+			}
+			shapedList.SetLimit(limit)
+		}
+		if arguments["--rank-range"] != nil {
+			var rankMin, rankMax int
+			_, err := fmt.Sscanf(arguments["--rank-range"].(string), "%d-%d", &rankMin, &rankMax)
+			if err != nil {
+				fmt.Println("Invalid rank range:", err)
+				os.Exit(2)
+			}
+			if rankMin < 1 || rankMax < rankMin {
+				fmt.Println("Invalid rank range, expected a-b with 1 <= a <= b:", arguments["--rank-range"])
+				os.Exit(2)
+			}
+			shapedList.SetRankRange(rankMin, rankMax)
+		}
+		if arguments["--sample"] != nil {
+			sampleSize, err := strconv.Atoi(arguments["--sample"].(string))
+			if err != nil || sampleSize < 1 {
+				fmt.Println("Invalid sample size, expected a positive number:", arguments["--sample"])
+				os.Exit(2)
+			}
+			shapedList.SetSample(sampleSize)
+		}
+		if arguments["--sample-fraction"] != nil {
+			sampleFraction, err := strconv.ParseFloat(arguments["--sample-fraction"].(string), 64)
+			if err != nil || !(sampleFraction > 0 && sampleFraction <= 1) {
+				fmt.Println("Invalid sample fraction, expected a number above 0 and at most 1:", arguments["--sample-fraction"])
+				os.Exit(2)
+			}
+			shapedList.SetSampleFraction(sampleFraction)
+		}
+		seed := time.Now().UnixNano()
+		if arguments["--seed"] != nil {
+			var err error
+			seed, err = strconv.ParseInt(arguments["--seed"].(string), 10, 64)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(2)
+			}
+		} else if arguments["--sample"] != nil || arguments["--sample-fraction"] != nil {
+			log.Printf("Sampling with seed %d", seed)
+		}
+		shapedList.SetSeed(seed)
+		testList = shapedList
+	}
+
+	if arguments["--expand"] != nil {
+		labels, err := hellfire.ReadLabelsFile(arguments["--expand"].(string))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		testList = hellfire.NewSubdomainExpander(testList, labels)
+	}
+
+	if metadata := arguments["--meta"].([]string); len(metadata) > 0 || arguments["--meta-file"] != nil {
+		metadataList := hellfire.NewMetadataList(testList)
+		if arguments["--meta-file"] != nil {
+			err := metadataList.LoadFile(arguments["--meta-file"].(string))
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(2)
+			}
+		}
+		for _, field := range metadata {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok || key == "" {
+				fmt.Println("Invalid metadata, expected key=value:", field)
+				os.Exit(2)
+			}
+			metadataList.Set(key, value)
+		}
+		testList = metadataList
+	}
+
+	// Stop feeding jobs on an interrupt, completing the lookups for jobs
+	// already submitted
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err := hellfire.PerformLookupsContext(ctx, testList, hellfire.LookupOptions{
+		LookupType:       lookupType,
+		Family:           family,
+		OutputType:       outputType,
+		CanidAddress:     canidAddress,
+		QueriesPerSecond: queriesPerSecond,
+		Filters:          filters,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
 }
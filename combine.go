@@ -0,0 +1,92 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"context"
+	"strings"
+)
+
+// A CombinedList merges the jobs from several other TestLists, as either the
+// union or the intersection of the domains in each list. Each domain is
+// submitted once, with the metadata of its first appearance and a
+// "hellfire_sources" field listing every list and rank that contributed it.
+//
+// Jobs without a domain cannot be combined. These are passed through in a
+// union and dropped in an intersection.
+type CombinedList struct {
+	TestList
+	names        []string
+	lists        []TestList
+	intersection bool
+}
+
+type combinedJob struct {
+	job     map[string]interface{}
+	sources []map[string]interface{}
+	lists   map[int]bool
+}
+
+// The AddList method adds a list to be combined. The name is used to record
+// the provenance of each job.
+func (l *CombinedList) AddList(name string, testList TestList) {
+	l.names = append(l.names, name)
+	l.lists = append(l.lists, testList)
+}
+
+// The SetIntersection method selects whether to submit only those domains
+// that appear in every list (true), or those that appear in any list (false).
+// The union is used by default.
+func (l *CombinedList) SetIntersection(intersection bool) {
+	l.intersection = intersection
+}
+
+func (l *CombinedList) FeedJobs(jobs chan map[string]interface{}) {
+	feedJobs(l, jobs)
+}
+
+func (l *CombinedList) Feed(ctx context.Context, jobs chan map[string]interface{}) error {
+	var order []string
+	combined := make(map[string]*combinedJob)
+
+	for idx, testList := range l.lists {
+		name := l.names[idx]
+		err := feedThrough(ctx, testList, func(job map[string]interface{}) error {
+			domain, ok := job["domain"].(string)
+			if !ok || domain == "" {
+				if !l.intersection {
+					return sendJob(ctx, jobs, job)
+				}
+				return nil
+			}
+			domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+			c, seen := combined[domain]
+			if !seen {
+				c = &combinedJob{job: job, lists: make(map[int]bool)}
+				combined[domain] = c
+				order = append(order, domain)
+			}
+			source := map[string]interface{}{"list": name}
+			if job["rank"] != nil {
+				source["rank"] = job["rank"]
+			}
+			c.sources = append(c.sources, source)
+			c.lists[idx] = true
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, domain := range order {
+		c := combined[domain]
+		if l.intersection && len(c.lists) < len(l.lists) {
+			continue
+		}
+		c.job["hellfire_sources"] = c.sources
+		err := sendJob(ctx, jobs, c.job)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
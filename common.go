@@ -3,12 +3,20 @@
 // formatted using CSV and JSON schemas.
 //
 // Any method of importing missions must implement the TestList interface.
+// Implementations can be made available by name, including from outside
+// this package, by registering them with RegisterSource.
 package hellfire // import "pathspider.net/hellfire"
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"net/url"
+	"os"
 )
 
 // The TestList interface describes the methods that are used by hellfire
@@ -28,13 +36,138 @@ type TestList interface {
 	SetFilename(string)
 }
 
+// The Feeder interface is the successor to the TestList interface, allowing
+// failures to be reported and feeding to be cancelled. TestLists that also
+// implement Feeder are fed using the Feed method in place of FeedJobs.
+type Feeder interface {
+	// The Feed method should submit jobs into the chan that has been
+	// passed to it, with the same requirements on the jobs as for the
+	// FeedJobs method of TestList. It returns nil once all jobs have been
+	// submitted, or returns an error as soon as the context is cancelled
+	// or a failure occurs, such as a malformed entry or a download that
+	// could not be completed.
+	Feed(ctx context.Context, jobs chan map[string]interface{}) error
+}
+
+// The AsFeeder function returns a Feeder for a TestList. TestLists that
+// implement Feeder are returned unchanged. For any other TestList, FeedJobs is
+// called and a panic during feeding is returned as an error. As FeedJobs
+// cannot be interrupted, any remaining jobs are discarded once the context is
+// cancelled.
+func AsFeeder(testList TestList) Feeder {
+	if feeder, ok := testList.(Feeder); ok {
+		return feeder
+	}
+	return &testListFeeder{testList}
+}
+
+type testListFeeder struct {
+	testList TestList
+}
+
+func (f *testListFeeder) Feed(ctx context.Context, jobs chan map[string]interface{}) error {
+	inner := make(chan map[string]interface{})
+	failed := make(chan error, 1)
+
+	go func() {
+		defer close(inner)
+		defer func() {
+			if r := recover(); r != nil {
+				failed <- fmt.Errorf("%v", r)
+			}
+		}()
+		f.testList.FeedJobs(inner)
+	}()
+
+	for job := range inner {
+		err := sendJob(ctx, jobs, job)
+		if err != nil {
+			go func() {
+				for range inner {
+				}
+			}()
+			return err
+		}
+	}
+
+	select {
+	case err := <-failed:
+		return err
+	default:
+		return nil
+	}
+}
+
+// Submits a job, unless the context is cancelled first.
+func sendJob(ctx context.Context, jobs chan map[string]interface{}, job map[string]interface{}) error {
+	select {
+	case jobs <- job:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Implements the FeedJobs method of the TestList interface for a Feeder. As
+// FeedJobs cannot report failures, this panics on any error.
+func feedJobs(feeder Feeder, jobs chan map[string]interface{}) {
+	err := feeder.Feed(context.Background(), jobs)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// The filename that may be given in place of a file to read from standard
+// input.
+const StdinFilename string = "-"
+
+// Opens a file for reading, or returns standard input if the filename is
+// StdinFilename.
+func openFile(filename string) (io.Reader, error) {
+	if filename == StdinFilename {
+		return os.Stdin, nil
+	}
+	return os.Open(filename)
+}
+
+// Downloads the contents of a URL. If a cache directory has been set, the
+// cached copy is used when the server reports that it has not been modified,
+// and when offline the cached copy is always used.
 func getReaderFromUrl(url string) (*bytes.Reader, error) {
-	res, err := http.Get(url)
+	cached, metadata, cacheErr := readCache(url)
+	if offline {
+		if cacheErr != nil {
+			return nil, fmt.Errorf("offline: %s", cacheErr)
+		}
+		return bytes.NewReader(cached), nil
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cacheErr == nil {
+		if metadata.ETag != "" {
+			req.Header.Set("If-None-Match", metadata.ETag)
+		}
+		if metadata.LastModified != "" {
+			req.Header.Set("If-Modified-Since", metadata.LastModified)
+		}
+	}
+
+	res, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer res.Body.Close()
 
+	if res.StatusCode == http.StatusNotModified && cacheErr == nil {
+		return bytes.NewReader(cached), nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", res.Status)
+	}
+
 	buf := &bytes.Buffer{}
 
 	_, err = io.Copy(buf, res.Body)
@@ -42,5 +175,76 @@ func getReaderFromUrl(url string) (*bytes.Reader, error) {
 		return nil, err
 	}
 
+	err = writeCache(buf.Bytes(), &cacheMetadata{
+		URL:          url,
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+	})
+	if err != nil {
+		log.Printf("Unable to cache <%s>: %s", url, err)
+	}
+
 	return bytes.NewReader(buf.Bytes()), nil
 }
+
+// Returned by a jobTransform to stop feeding early without an error, e.g.
+// once a limit has been reached.
+var errStopFeeding = errors.New("stop feeding")
+
+// A jobTransform is called by feedThrough for each job, and submits any number
+// of jobs in its place with sendJob, usually to the chan passed to the Feed
+// method of the wrapping list.
+type jobTransform func(job map[string]interface{}) error
+
+// Feeds the jobs from a TestList through a jobTransform, allowing lists to be
+// wrapped by others that transform or filter their jobs. Once the transform
+// returns an error, the TestList is no longer fed. Returning errStopFeeding
+// stops feeding without an error.
+// This returns once all jobs have been fed, or with an error if feeding the
+// TestList fails, the transform fails, or the context is cancelled.
+func feedThrough(ctx context.Context, testList TestList, transform jobTransform) error {
+	innerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	inner := make(chan map[string]interface{})
+	done := make(chan error, 1)
+
+	go func() {
+		var err error
+		for job := range inner {
+			if err != nil {
+				// Discard jobs until the TestList notices the
+				// cancellation
+				continue
+			}
+			err = transform(job)
+			if err != nil {
+				cancel()
+			}
+		}
+		done <- err
+	}()
+
+	err := AsFeeder(testList).Feed(innerCtx, inner)
+	close(inner)
+	if transformErr := <-done; transformErr == errStopFeeding {
+		return nil
+	} else if transformErr != nil {
+		return transformErr
+	}
+	return err
+}
+
+// Sets the "domain" key of a job from the host portion of its "url" key, as
+// described for the TestList interface, if the job has no domain already.
+func setDomainFromURL(job map[string]interface{}) {
+	if job["domain"] == nil && job["url"] != nil {
+		rawURL, ok := job["url"].(string)
+		if !ok {
+			return
+		}
+		u, err := url.Parse(rawURL)
+		if err == nil {
+			job["domain"] = u.Hostname()
+		}
+	}
+}
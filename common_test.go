@@ -0,0 +1,20 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"context"
+)
+
+// Feeds a TestList and returns the jobs submitted and any error.
+func collectJobs(testList Feeder) ([]map[string]interface{}, error) {
+	jobs := make(chan map[string]interface{})
+	done := make(chan error, 1)
+	go func() {
+		done <- testList.Feed(context.Background(), jobs)
+		close(jobs)
+	}()
+	var collected []map[string]interface{}
+	for job := range jobs {
+		collected = append(collected, job)
+	}
+	return collected, <-done
+}
@@ -0,0 +1,65 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Magic bytes identifying the supported compressed formats
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	xzMagic    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	zipMagic   = []byte{'P', 'K', 0x03, 0x04}
+)
+
+// Returns a reader for the decompressed contents of a reader. The gzip, bzip2,
+// xz, zstd and zip formats are detected by their magic bytes, and input in
+// any other format is returned unchanged. For zip archives, the first file in
+// the archive is read.
+func decompressReader(reader io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(reader)
+	magic, _ := br.Peek(6)
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, bzip2Magic):
+		return bzip2.NewReader(br), nil
+	case bytes.HasPrefix(magic, xzMagic):
+		return xz.NewReader(br)
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	case bytes.HasPrefix(magic, zipMagic):
+		// The zip format must be read from the end, so the whole
+		// archive is read into memory first.
+		buf, err := io.ReadAll(br)
+		if err != nil {
+			return nil, err
+		}
+		zr, err := zip.NewReader(bytes.NewReader(buf), int64(len(buf)))
+		if err != nil {
+			return nil, err
+		}
+		for _, zf := range zr.File {
+			if !zf.FileInfo().IsDir() {
+				return zf.Open()
+			}
+		}
+		return nil, errors.New("zip archive contains no files")
+	}
+	return br, nil
+}
@@ -0,0 +1,62 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"context"
+	"fmt"
+)
+
+type CrUXTopOriginsList struct {
+	TestList
+	filename string
+}
+
+// URL to download the latest global Chrome UX Report top origins list from
+const CrUXTopOriginsURL string = "https://raw.githubusercontent.com/zakird/crux-top-lists/main/data/global/current.csv.gz"
+
+func init() {
+	RegisterSource(Source{
+		Name: "crux",
+		New: func(options map[string]string) (TestList, error) {
+			l := new(CrUXTopOriginsList)
+			l.SetFilename(options[FileOption])
+			return l, nil
+		},
+	})
+}
+
+func (l *CrUXTopOriginsList) SetFilename(filename string) {
+	l.filename = filename
+}
+
+func (l *CrUXTopOriginsList) FeedJobs(jobs chan map[string]interface{}) {
+	feedJobs(l, jobs)
+}
+
+// The Feed method submits a job for each origin in the list. The "origin"
+// column is used as the URL of the job, with the domain taken from its host
+// portion. The "rank" column gives the popularity bucket of the origin (e.g.
+// 1000 for the top thousand origins) rather than an individual rank.
+func (l *CrUXTopOriginsList) Feed(ctx context.Context, jobs chan map[string]interface{}) error {
+	var cruxList *CSVList
+
+	if l.filename == "" {
+		urlReader, source, err := getReaderFromSource("crux")
+		if err != nil {
+			return fmt.Errorf("unable to get <%s>: %s", source, err)
+		}
+
+		cruxList = CSVListFromReader(urlReader)
+	} else {
+		var err error
+		cruxList, err = OpenCSVList(l.filename)
+		if err != nil {
+			return err
+		}
+	}
+
+	return feedThrough(ctx, cruxList, func(job map[string]interface{}) error {
+		job["url"] = job["origin"]
+		setDomainFromURL(job)
+		return sendJob(ctx, jobs, job)
+	})
+}
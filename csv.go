@@ -2,27 +2,133 @@ package hellfire // import "pathspider.net/hellfire"
 
 import (
 	"bufio"
+	"context"
 	"encoding/csv"
+	"errors"
+	"fmt"
 	"io"
-	"net/url"
-	"os"
+	"log"
+	"strconv"
+	"unicode/utf8"
 )
 
 // A CSVList handles input in CSV format. There may be a more specific type
 // available and that should be used if that is the case (e.g. for the
 // Alexa or Citizen Lab test lists).
+//
+// By default the input is comma-delimited with a header row naming the
+// fields of each job, and rows must all have the same number of fields. The
+// delimiter, comment character, number of leading rows to skip and the
+// columns holding the domain or URL can all be set, as can lenient handling
+// of rows with missing or extra fields.
 type CSVList struct {
 	TestList
-	reader io.Reader
-	header []string
+	reader       io.Reader
+	header       []string
+	noHeader     bool
+	delimiter    rune
+	comment      rune
+	skipRows     int
+	domainColumn string
+	urlColumn    string
+	lenient      bool
 }
 
+func init() {
+	RegisterSource(Source{
+		Name: "csv",
+		Options: []string{"domain-column", "url-column", "delimiter",
+			"comment", "skip-rows", "no-header", "lenient"},
+		New: func(options map[string]string) (TestList, error) {
+			if err := requireFile("csv", options); err != nil {
+				return nil, err
+			}
+			l, err := OpenCSVList(options[FileOption])
+			if err != nil {
+				return nil, err
+			}
+			err = setCSVOptions(l, options)
+			if err != nil {
+				return nil, err
+			}
+			return l, nil
+		},
+	})
+}
+
+// Applies the options accepted by the csv source.
+func setCSVOptions(l *CSVList, options map[string]string) error {
+	if options["domain-column"] != "" {
+		l.SetDomainColumn(options["domain-column"])
+	}
+	if options["url-column"] != "" {
+		l.SetURLColumn(options["url-column"])
+	}
+	if options["delimiter"] != "" {
+		delimiter, err := parseCSVCharacter(options["delimiter"])
+		if err != nil {
+			return fmt.Errorf("invalid delimiter: %s", err)
+		}
+		l.SetDelimiter(delimiter)
+	}
+	if options["comment"] != "" {
+		comment, err := parseCSVCharacter(options["comment"])
+		if err != nil {
+			return fmt.Errorf("invalid comment character: %s", err)
+		}
+		l.SetComment(comment)
+	}
+	if options["skip-rows"] != "" {
+		skipRows, err := strconv.Atoi(options["skip-rows"])
+		if err != nil || skipRows < 0 {
+			return fmt.Errorf("invalid number of rows to skip: %s", options["skip-rows"])
+		}
+		l.SetSkipRows(skipRows)
+	}
+	if options["no-header"] == "true" {
+		l.SetNoHeader(true)
+	}
+	if options["lenient"] == "true" {
+		l.SetLenient(true)
+	}
+	return nil
+}
+
+// Parses a delimiter or comment character, which must be a single character
+// or one of the names "tab", "space", or the escape "\t".
+func parseCSVCharacter(s string) (rune, error) {
+	switch s {
+	case "tab", "\\t":
+		return '\t', nil
+	case "space":
+		return ' ', nil
+	}
+	if utf8.RuneCountInString(s) != 1 {
+		return 0, fmt.Errorf("%q is not a single character", s)
+	}
+	r, _ := utf8.DecodeRuneInString(s)
+	return r, nil
+}
+
+// The CSVListFromFile function creates a CSVList reading from the named file,
+// or from standard input if the filename is "-". It panics if the file cannot
+// be opened; OpenCSVList returns an error instead.
 func CSVListFromFile(filename string) *CSVList {
-	f, err := os.Open(filename)
+	l, err := OpenCSVList(filename)
 	if err != nil {
 		panic("Error opening file")
 	}
-	return CSVListFromReader(f)
+	return l
+}
+
+// The OpenCSVList function creates a CSVList reading from the named file, or
+// from standard input if the filename is "-".
+func OpenCSVList(filename string) (*CSVList, error) {
+	f, err := openFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return CSVListFromReader(f), nil
 }
 
 func CSVListFromReader(reader io.Reader) *CSVList {
@@ -31,38 +137,211 @@ func CSVListFromReader(reader io.Reader) *CSVList {
 	return l
 }
 
+// The SetHeader method sets the names of the fields in each row. When set,
+// the first row of the input is treated as data unless it is skipped.
 func (l *CSVList) SetHeader(header []string) {
 	l.header = header
 }
 
+// The SetNoHeader method selects whether the input has no header row. Without
+// a header or names set with SetHeader, fields are named by their position,
+// i.e. "column1", "column2" and so on, and the domain is taken from the first
+// column unless another is selected.
+func (l *CSVList) SetNoHeader(noHeader bool) {
+	l.noHeader = noHeader
+}
+
+// The SetDelimiter method sets the character that separates fields, e.g. '\t'
+// for tab-separated input. The default is a comma.
+func (l *CSVList) SetDelimiter(delimiter rune) {
+	l.delimiter = delimiter
+}
+
+// The SetComment method sets a character that, at the start of a row, marks
+// the row as a comment to be ignored. By default no rows are comments.
+func (l *CSVList) SetComment(comment rune) {
+	l.comment = comment
+}
+
+// The SetSkipRows method sets a number of lines at the start of the input to
+// be ignored, before the header row if there is one.
+func (l *CSVList) SetSkipRows(skipRows int) {
+	l.skipRows = skipRows
+}
+
+// The SetDomainColumn method selects the column that holds the domain, by
+// the name given in the header or by its position counting from 1.
+func (l *CSVList) SetDomainColumn(column string) {
+	l.domainColumn = column
+}
+
+// The SetURLColumn method selects the column that holds a URL, by the name
+// given in the header or by its position counting from 1. The domain is taken
+// from the URL unless a domain column has also been selected.
+func (l *CSVList) SetURLColumn(column string) {
+	l.urlColumn = column
+}
+
+// The SetLenient method selects whether rows with a different number of
+// fields than the header are accepted. Missing fields are left out of the
+// job, extra fields are ignored, and rows that are missing the domain or URL
+// column are skipped. By default such rows are an error.
+func (l *CSVList) SetLenient(lenient bool) {
+	l.lenient = lenient
+}
+
+// Returns the index of a column given by name or by position counting from 1,
+// or -1 if no column was given.
+func csvColumnIndex(column string, header []string) (int, error) {
+	if column == "" {
+		return -1, nil
+	}
+	for idx, name := range header {
+		if name == column {
+			return idx, nil
+		}
+	}
+	position, err := strconv.Atoi(column)
+	if err != nil || position < 1 {
+		return -1, fmt.Errorf("no such column: %s", column)
+	}
+	return position - 1, nil
+}
+
+// Adjusts the line numbers in a CSV parse error to count any skipped rows, so
+// that they match the lines of the input.
+func (l *CSVList) offsetError(err error) error {
+	if parseErr, ok := err.(*csv.ParseError); ok {
+		parseErr.StartLine += l.skipRows
+		parseErr.Line += l.skipRows
+	}
+	return err
+}
+
 func (l *CSVList) FeedJobs(jobs chan map[string]interface{}) {
-	reader := csv.NewReader(bufio.NewReader(l.reader))
-	if reader == nil {
-		panic("CSVList not initialised with a reader")
+	feedJobs(l, jobs)
+}
+
+// The Feed method submits a job for each row of the CSV. Input compressed
+// with gzip, bzip2, xz, zstd or zip is decompressed transparently.
+func (l *CSVList) Feed(ctx context.Context, jobs chan map[string]interface{}) error {
+	if l.reader == nil {
+		return errors.New("CSVList not initialised with a reader")
+	}
+	decompressed, err := decompressReader(l.reader)
+	if err != nil {
+		return fmt.Errorf("error decompressing the CSV: %s", err)
 	}
+	buffered := bufio.NewReader(decompressed)
+	for i := 0; i < l.skipRows; i++ {
+		_, err = buffered.ReadString('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading the CSV: %s", err)
+		}
+	}
+
+	reader := csv.NewReader(buffered)
+	if l.delimiter != 0 {
+		reader.Comma = l.delimiter
+	}
+	reader.Comment = l.comment
+	if l.lenient {
+		reader.FieldsPerRecord = -1
+	} else if l.header != nil {
+		reader.FieldsPerRecord = len(l.header)
+	}
+
 	var header []string
-	if l.header == nil {
-		var err error
+	var first []string
+	switch {
+	case l.header != nil:
+		header = l.header
+	case l.noHeader:
+		first, err = reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading the CSV: %s", l.offsetError(err))
+		}
+		for idx := range first {
+			header = append(header, fmt.Sprintf("column%d", idx+1))
+		}
+	default:
 		header, err = reader.Read()
+		if err == io.EOF {
+			return nil
+		}
 		if err != nil {
-			panic("Error reading the header from the CSV")
+			return fmt.Errorf("error reading the header from the CSV: %s", l.offsetError(err))
 		}
-	} else {
-		header = l.header
 	}
+
+	domainColumn := l.domainColumn
+	if domainColumn == "" && l.urlColumn == "" && l.header == nil && l.noHeader {
+		domainColumn = "1"
+	}
+	domainIdx, err := csvColumnIndex(domainColumn, header)
+	if err != nil {
+		return err
+	}
+	urlIdx, err := csvColumnIndex(l.urlColumn, header)
+	if err != nil {
+		return err
+	}
+	if domainIdx < 0 && urlIdx < 0 {
+		// Without a column selected, the domain is taken from the column
+		// named "domain" in the header, so rows must reach that column
+		for idx, name := range header {
+			if name == "domain" {
+				domainIdx = idx
+				break
+			}
+		}
+	}
+
 	for {
-		record, err := reader.Read()
-		if err == io.EOF {
-			break
+		var record []string
+		if first != nil {
+			record, first = first, nil
+		} else {
+			record, err = reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("error reading the CSV: %s", l.offsetError(err))
+			}
+		}
+		if domainIdx >= len(record) || urlIdx >= len(record) {
+			line, _ := reader.FieldPos(0)
+			line += l.skipRows
+			if l.lenient {
+				log.Printf("Skipping CSV record on line %d: missing the domain or URL column", line)
+				continue
+			}
+			return fmt.Errorf("error reading the CSV: record on line %d: missing the domain or URL column", line)
 		}
 		r := make(map[string]interface{})
 		for idx, name := range header {
-			r[name] = record[idx]
+			if idx < len(record) {
+				r[name] = record[idx]
+			}
+		}
+		if domainIdx >= 0 {
+			r["domain"] = record[domainIdx]
 		}
-		if r["domain"] == nil && r["url"] != nil {
-			u, _ := url.Parse(r["url"].(string))
-			r["domain"] = u.Host
+		if urlIdx >= 0 {
+			r["url"] = record[urlIdx]
+		}
+		setDomainFromURL(r)
+		err = sendJob(ctx, jobs, r)
+		if err != nil {
+			return err
 		}
-		jobs <- r
 	}
+	return nil
 }
@@ -0,0 +1,176 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCSVList(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		setup func(l *CSVList)
+		want  []map[string]interface{}
+	}{
+		{
+			name:  "header",
+			input: "rank,domain\n1,example.com\n2,example.net\n",
+			want: []map[string]interface{}{
+				{"rank": "1", "domain": "example.com"},
+				{"rank": "2", "domain": "example.net"},
+			},
+		},
+		{
+			name:  "domain column by name",
+			input: "rank,name\n1,example.com\n",
+			setup: func(l *CSVList) { l.SetDomainColumn("name") },
+			want:  []map[string]interface{}{{"rank": "1", "name": "example.com", "domain": "example.com"}},
+		},
+		{
+			name:  "domain column by position",
+			input: "rank,name\n1,example.com\n",
+			setup: func(l *CSVList) { l.SetDomainColumn("2") },
+			want:  []map[string]interface{}{{"rank": "1", "name": "example.com", "domain": "example.com"}},
+		},
+		{
+			name:  "url column",
+			input: "id,link\n1,https://example.com/a\n",
+			setup: func(l *CSVList) { l.SetURLColumn("link") },
+			want: []map[string]interface{}{
+				{"id": "1", "link": "https://example.com/a", "url": "https://example.com/a", "domain": "example.com"},
+			},
+		},
+		{
+			name:  "headerless",
+			input: "example.com,1\nexample.net,2\n",
+			setup: func(l *CSVList) { l.SetNoHeader(true) },
+			want: []map[string]interface{}{
+				{"column1": "example.com", "column2": "1", "domain": "example.com"},
+				{"column1": "example.net", "column2": "2", "domain": "example.net"},
+			},
+		},
+		{
+			name:  "headerless with domain column",
+			input: "1,example.com\n",
+			setup: func(l *CSVList) { l.SetNoHeader(true); l.SetDomainColumn("2") },
+			want:  []map[string]interface{}{{"column1": "1", "column2": "example.com", "domain": "example.com"}},
+		},
+		{
+			name:  "header set",
+			input: "1,example.com\n",
+			setup: func(l *CSVList) { l.SetHeader([]string{"rank", "domain"}) },
+			want:  []map[string]interface{}{{"rank": "1", "domain": "example.com"}},
+		},
+		{
+			name:  "skip rows, delimiter and comment",
+			input: "generated 2020-01-01\n\nrank\tdomain\n# comment\n1\texample.com\n",
+			setup: func(l *CSVList) { l.SetSkipRows(2); l.SetDelimiter('\t'); l.SetComment('#') },
+			want:  []map[string]interface{}{{"rank": "1", "domain": "example.com"}},
+		},
+		{
+			name:  "lenient with ragged rows",
+			input: "domain,rank,category\nexample.com,1\nexample.net,2,news,extra\n,\n",
+			setup: func(l *CSVList) { l.SetLenient(true) },
+			want: []map[string]interface{}{
+				{"domain": "example.com", "rank": "1"},
+				{"domain": "example.net", "rank": "2", "category": "news"},
+				{"domain": "", "rank": ""},
+			},
+		},
+		{
+			name:  "lenient skips rows missing the domain column",
+			input: "rank,domain\n1\n2,example.com\n",
+			setup: func(l *CSVList) { l.SetLenient(true) },
+			want:  []map[string]interface{}{{"rank": "2", "domain": "example.com"}},
+		},
+		{
+			name:  "empty",
+			input: "",
+		},
+	}
+	for _, test := range tests {
+		l := CSVListFromReader(strings.NewReader(test.input))
+		if test.setup != nil {
+			test.setup(l)
+		}
+		got, err := collectJobs(l)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		} else if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCSVListErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		setup func(l *CSVList)
+		error string
+	}{
+		{
+			name:  "ragged",
+			input: "domain,rank\nexample.com,1\nexample.net\n",
+			error: "line 3",
+		},
+		{
+			name:  "ragged after skipped rows",
+			input: "skipped\ndomain,rank\nexample.com\n",
+			setup: func(l *CSVList) { l.SetSkipRows(1) },
+			error: "line 3",
+		},
+		{
+			name:  "ragged with header set",
+			input: "1,example.com,extra\n",
+			setup: func(l *CSVList) { l.SetHeader([]string{"rank", "domain"}) },
+			error: "wrong number of fields",
+		},
+		{
+			name:  "no such column",
+			input: "rank,name\n1,example.com\n",
+			setup: func(l *CSVList) { l.SetDomainColumn("domain") },
+			error: "no such column: domain",
+		},
+		{
+			name:  "column beyond the row",
+			input: "rank,name\n1,example.com\n",
+			setup: func(l *CSVList) { l.SetDomainColumn("3") },
+			error: "missing the domain or URL column",
+		},
+	}
+	for _, test := range tests {
+		l := CSVListFromReader(strings.NewReader(test.input))
+		if test.setup != nil {
+			test.setup(l)
+		}
+		_, err := collectJobs(l)
+		if err == nil || !strings.Contains(err.Error(), test.error) {
+			t.Errorf("%s: got error %v, want one containing %q", test.name, err, test.error)
+		}
+	}
+}
+
+func TestParseCSVCharacter(t *testing.T) {
+	tests := []struct {
+		s    string
+		want rune
+		ok   bool
+	}{
+		{",", ',', true},
+		{";", ';', true},
+		{"tab", '\t', true},
+		{"\\t", '\t', true},
+		{"space", ' ', true},
+		{"|", '|', true},
+		{"", 0, false},
+		{",,", 0, false},
+	}
+	for _, test := range tests {
+		got, err := parseCSVCharacter(test.s)
+		if (err == nil) != test.ok || got != test.want {
+			t.Errorf("parseCSVCharacter(%q): got %q, %v", test.s, got, err)
+		}
+	}
+}
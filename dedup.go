@@ -0,0 +1,111 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"context"
+	"reflect"
+)
+
+// A DomainDeduplicator wraps another TestList and submits a single job for
+// each domain, so that a domain appearing in several rows of a list is only
+// looked up once. As all rows must be read before the jobs can be merged, no
+// jobs are submitted until the wrapped TestList has been fed completely.
+//
+// The jobs for a domain are merged field by field. Where every row has the
+// same value for a field, or only one row has the field, the value is kept
+// as it is. Otherwise, the field holds a list of the distinct values, in the
+// order that they were first seen. The exception is the "rank" field, which
+// holds the best (lowest) rank so that jobs can still be selected by rank,
+// with the distinct ranks listed in the "hellfire_ranks" field. The number of
+// rows merged is given in the "hellfire_input_rows" field. Jobs without a
+// domain are submitted unchanged.
+type DomainDeduplicator struct {
+	TestList
+}
+
+func NewDomainDeduplicator(testList TestList) *DomainDeduplicator {
+	d := new(DomainDeduplicator)
+	d.TestList = testList
+	return d
+}
+
+func (d *DomainDeduplicator) FeedJobs(jobs chan map[string]interface{}) {
+	feedJobs(d, jobs)
+}
+
+func (d *DomainDeduplicator) Feed(ctx context.Context, jobs chan map[string]interface{}) error {
+	var domains []string
+	merged := make(map[string][]map[string]interface{})
+
+	err := feedThrough(ctx, d.TestList, func(job map[string]interface{}) error {
+		domain, ok := job["domain"].(string)
+		if !ok || domain == "" {
+			return sendJob(ctx, jobs, job)
+		}
+		if _, seen := merged[domain]; !seen {
+			domains = append(domains, domain)
+		}
+		merged[domain] = append(merged[domain], job)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, domain := range domains {
+		err = sendJob(ctx, jobs, mergeJobs(merged[domain]))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Merges the jobs for a domain into a single job, listing the distinct values
+// of any field where the jobs differ.
+func mergeJobs(rows []map[string]interface{}) map[string]interface{} {
+	values := make(map[string][]interface{})
+	for _, row := range rows {
+		for key, value := range row {
+			if !containsValue(values[key], value) {
+				values[key] = append(values[key], value)
+			}
+		}
+	}
+
+	job := make(map[string]interface{})
+	for key, distinct := range values {
+		if len(distinct) == 1 {
+			job[key] = distinct[0]
+		} else {
+			job[key] = distinct
+		}
+	}
+	// The rank is kept as the best rank, so that the job can still be
+	// selected by rank, with the distinct ranks listed separately
+	if ranks := values["rank"]; len(ranks) > 1 {
+		var best interface{}
+		bestRank := 0
+		for _, row := range rows {
+			rank, ok := jobRank(row)
+			if ok && (best == nil || rank < bestRank) {
+				best, bestRank = row["rank"], rank
+			}
+		}
+		if best != nil {
+			job["rank"] = best
+			job["hellfire_ranks"] = ranks
+		}
+	}
+	job["hellfire_input_rows"] = len(rows)
+	return job
+}
+
+// Returns true if a value is among a list of values.
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if reflect.DeepEqual(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergeJobs(t *testing.T) {
+	tests := []struct {
+		name string
+		rows []map[string]interface{}
+		want map[string]interface{}
+	}{
+		{
+			name: "single row",
+			rows: []map[string]interface{}{{"domain": "example.com", "rank": "3"}},
+			want: map[string]interface{}{"domain": "example.com", "rank": "3", "hellfire_input_rows": 1},
+		},
+		{
+			name: "same values",
+			rows: []map[string]interface{}{
+				{"domain": "example.com", "rank": "3", "category": "NEWS"},
+				{"domain": "example.com", "rank": "3", "category": "NEWS"},
+			},
+			want: map[string]interface{}{"domain": "example.com", "rank": "3", "category": "NEWS", "hellfire_input_rows": 2},
+		},
+		{
+			name: "distinct values in order first seen",
+			rows: []map[string]interface{}{
+				{"domain": "example.com", "url": "http://example.com/b"},
+				{"domain": "example.com", "url": "http://example.com/a", "category": "NEWS"},
+				{"domain": "example.com", "url": "http://example.com/b"},
+			},
+			want: map[string]interface{}{
+				"domain":              "example.com",
+				"url":                 []interface{}{"http://example.com/b", "http://example.com/a"},
+				"category":            "NEWS",
+				"hellfire_input_rows": 3,
+			},
+		},
+		{
+			name: "best rank",
+			rows: []map[string]interface{}{
+				{"domain": "example.com", "rank": "20"},
+				{"domain": "example.com", "rank": "3"},
+				{"domain": "example.com", "rank": "100"},
+			},
+			want: map[string]interface{}{
+				"domain":              "example.com",
+				"rank":                "3",
+				"hellfire_ranks":      []interface{}{"20", "3", "100"},
+				"hellfire_input_rows": 3,
+			},
+		},
+		{
+			name: "best rank of mixed types",
+			rows: []map[string]interface{}{
+				{"domain": "example.com", "rank": json.Number("7")},
+				{"domain": "example.com", "rank": 5},
+				{"domain": "example.com", "rank": "unranked"},
+			},
+			want: map[string]interface{}{
+				"domain":              "example.com",
+				"rank":                5,
+				"hellfire_ranks":      []interface{}{json.Number("7"), 5, "unranked"},
+				"hellfire_input_rows": 3,
+			},
+		},
+		{
+			name: "no parseable rank",
+			rows: []map[string]interface{}{
+				{"domain": "example.com", "rank": "a"},
+				{"domain": "example.com", "rank": "b"},
+			},
+			want: map[string]interface{}{
+				"domain":              "example.com",
+				"rank":                []interface{}{"a", "b"},
+				"hellfire_input_rows": 2,
+			},
+		},
+	}
+	for _, test := range tests {
+		got := mergeJobs(test.rows)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDomainDeduplicatorRankRange(t *testing.T) {
+	input := "rank,domain\n1,example.com\n2,example.net\n3,example.com\n4,example.org\n"
+	l := NewShapedList(NewDomainDeduplicator(CSVListFromReader(strings.NewReader(input))))
+	l.SetRankRange(1, 2)
+	jobs, err := collectJobs(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]interface{}{
+		{"domain": "example.com", "rank": "1", "hellfire_ranks": []interface{}{"1", "3"}, "hellfire_input_rows": 2},
+		{"domain": "example.net", "rank": "2", "hellfire_input_rows": 1},
+	}
+	if !reflect.DeepEqual(jobs, want) {
+		t.Errorf("got %v, want %v", jobs, want)
+	}
+}
@@ -0,0 +1,103 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// A SubdomainExpander wraps another TestList and, for each job with a domain,
+// submits additional jobs for that domain prefixed with each of a list of
+// labels (e.g. "www", "mail" or "cdn"). The original job is submitted
+// unchanged, and the expanded jobs carry the original domain in the
+// "hellfire_expanded_from" field and the label used in the
+// "hellfire_expansion_label" field. Expanded names are normalised with
+// NormaliseDomain, and any that are not valid, e.g. as they are too long, are
+// logged and not submitted.
+type SubdomainExpander struct {
+	TestList
+	labels []string
+}
+
+func NewSubdomainExpander(testList TestList, labels []string) *SubdomainExpander {
+	e := new(SubdomainExpander)
+	e.TestList = testList
+	e.labels = labels
+	return e
+}
+
+// The ReadLabelsFile function reads a list of labels for subdomain expansion
+// from a file, with one label per line. Blank lines and lines starting with
+// "#" are ignored. Labels are normalised with NormaliseDomain, and an error is
+// returned for any label that is not valid.
+func ReadLabelsFile(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var labels []string
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		label := strings.Trim(strings.TrimSpace(scanner.Text()), ".")
+		if label == "" || strings.HasPrefix(label, "#") {
+			continue
+		}
+		label, err = NormaliseDomain(label)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", filename, lineNumber, err)
+		}
+		labels = append(labels, label)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+func (e *SubdomainExpander) FeedJobs(jobs chan map[string]interface{}) {
+	feedJobs(e, jobs)
+}
+
+func (e *SubdomainExpander) Feed(ctx context.Context, jobs chan map[string]interface{}) error {
+	return feedThrough(ctx, e.TestList, func(job map[string]interface{}) error {
+		domain, ok := job["domain"].(string)
+		if !ok || domain == "" {
+			return sendJob(ctx, jobs, job)
+		}
+		// The expanded jobs are copied before any are submitted, as the
+		// lookup workers modify jobs once they receive them.
+		expandedJobs := []map[string]interface{}{job}
+		for _, label := range e.labels {
+			expanded := make(map[string]interface{})
+			for key, value := range job {
+				expanded[key] = value
+			}
+			// The Unicode form of an internationalised domain
+			// does not apply to the expanded name
+			delete(expanded, "hellfire_unicode_domain")
+			name, err := NormaliseDomain(label + "." + domain)
+			if err != nil {
+				log.Printf("Not expanding %q with %q: %s", domain, label, err)
+				continue
+			}
+			expanded["domain"] = name
+			expanded["hellfire_expanded_from"] = domain
+			expanded["hellfire_expansion_label"] = label
+			expandedJobs = append(expandedJobs, expanded)
+		}
+		for _, expanded := range expandedJobs {
+			err := sendJob(ctx, jobs, expanded)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
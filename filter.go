@@ -0,0 +1,218 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// The ResultFilter interface describes the methods that are used by hellfire
+// to inspect lookup results before they are output.
+type ResultFilter interface {
+	// The FilterResult method is called once for each address resolved,
+	// with the result that will be output for that address. It may add
+	// annotations to the result, and returns false if the result should
+	// be dropped instead of being output.
+	FilterResult(result map[string]interface{}, ip net.IP) bool
+}
+
+// Special-purpose address ranges, based on the IANA IPv4 and IPv6
+// Special-Purpose Address Registries. Ranges that the registries mark as
+// globally reachable are not included.
+var specialPurposeRanges = []struct {
+	cidr   string
+	reason string
+}{
+	{"0.0.0.0/8", "this-network"},
+	{"10.0.0.0/8", "private"},
+	{"100.64.0.0/10", "cgnat"},
+	{"127.0.0.0/8", "loopback"},
+	{"169.254.0.0/16", "link-local"},
+	{"172.16.0.0/12", "private"},
+	{"192.0.0.0/24", "ietf-protocol"},
+	{"192.0.2.0/24", "documentation"},
+	{"192.88.99.0/24", "6to4-relay"},
+	{"192.168.0.0/16", "private"},
+	{"198.18.0.0/15", "benchmarking"},
+	{"198.51.100.0/24", "documentation"},
+	{"203.0.113.0/24", "documentation"},
+	{"224.0.0.0/4", "multicast"},
+	{"240.0.0.0/4", "reserved"},
+	{"::/128", "unspecified"},
+	{"::1/128", "loopback"},
+	{"::ffff:0:0/96", "ipv4-mapped"},
+	{"64:ff9b:1::/48", "nat64-local"},
+	{"100::/64", "discard"},
+	{"2001:2::/48", "benchmarking"},
+	{"2001:10::/28", "orchid"},
+	{"2001:db8::/32", "documentation"},
+	{"2002::/16", "6to4"},
+	{"3fff::/20", "documentation"},
+	{"fc00::/7", "unique-local"},
+	{"fe80::/10", "link-local"},
+	{"ff00::/8", "multicast"},
+}
+
+type filterEntry struct {
+	network   *net.IPNet
+	reason    string
+	blockpage bool
+}
+
+// An AddressFilter drops or flags resolved addresses that fall within any of
+// a set of address ranges. The special-purpose ranges, such as private,
+// loopback and documentation ranges, can be added with AddSpecialPurpose and
+// further ranges can be added from a deny list.
+//
+// When flagging rather than dropping, the reason for the match is added to
+// the result in the "hellfire_filtered" field. Results that a SinkholeList
+// earlier in the filters has flagged as a known blockpage are always flagged
+// rather than dropped.
+type AddressFilter struct {
+	ResultFilter
+	entries []filterEntry
+	flag    bool
+}
+
+// The SetFlag method selects whether matching addresses are flagged (true) or
+// dropped (false). Addresses are dropped by default.
+func (f *AddressFilter) SetFlag(flag bool) {
+	f.flag = flag
+}
+
+// The AddSpecialPurpose method adds the IANA special-purpose address ranges to
+// the filter.
+func (f *AddressFilter) AddSpecialPurpose() {
+	for _, r := range specialPurposeRanges {
+		err := f.AddCIDR(r.cidr, r.reason)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+// The AddCIDR method adds a single address range to the filter. The reason
+// will be used to annotate results when flagging matches.
+func (f *AddressFilter) AddCIDR(cidr string, reason string) error {
+	network, err := parseCIDROrIP(cidr)
+	if err != nil {
+		return err
+	}
+	f.entries = append(f.entries, filterEntry{network, reason, false})
+	return nil
+}
+
+// The LoadDenyList method adds the address ranges listed in a file to the
+// filter. The file contains one range in CIDR notation per line, optionally
+// followed by a reason. Blank lines and lines starting with "#" are ignored.
+// Ranges listed without a reason are given the reason "deny".
+func (f *AddressFilter) LoadDenyList(filename string) error {
+	entries, err := loadCIDRList(filename, "deny")
+	if err != nil {
+		return err
+	}
+	f.entries = append(f.entries, entries...)
+	return nil
+}
+
+// The Match method returns the reason for the first range that contains the
+// address, or an empty string if no range contains the address.
+func (f *AddressFilter) Match(ip net.IP) string {
+	return matchEntries(f.entries, ip)
+}
+
+func (f *AddressFilter) FilterResult(result map[string]interface{}, ip net.IP) bool {
+	reason := f.Match(ip)
+	if reason == "" {
+		return true
+	}
+	// Known blockpages are kept, so that blockpages at special-purpose
+	// addresses are still reported
+	if f.flag || result["hellfire_blockpage"] == true {
+		result["hellfire_filtered"] = reason
+		return true
+	}
+	return false
+}
+
+// Parses an address range in CIDR notation, also accepting a single address
+// as a range containing only that address.
+func parseCIDROrIP(cidr string) (*net.IPNet, error) {
+	if !strings.Contains(cidr, "/") {
+		ip := net.ParseIP(cidr)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid address: %s", cidr)
+		}
+		if ip.To4() != nil {
+			return &net.IPNet{IP: ip.To4(), Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	_, network, err := net.ParseCIDR(cidr)
+	return network, err
+}
+
+// Reads a file listing one address range per line, optionally followed by
+// whitespace and a label. Blank lines and lines starting with "#" are ignored.
+// Ranges listed without a label are given the default label.
+func loadCIDRList(filename string, defaultLabel string) ([]filterEntry, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []filterEntry
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		network, err := parseCIDROrIP(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", filename, lineNumber, err)
+		}
+		label := defaultLabel
+		if len(fields) > 1 {
+			label = strings.Join(fields[1:], " ")
+		}
+		entries = append(entries, filterEntry{network, label, false})
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Returns the label of the first entry that contains the address, or an
+// empty string if no entry contains the address.
+func matchEntries(entries []filterEntry, ip net.IP) string {
+	if entry := matchEntry(entries, ip); entry != nil {
+		return entry.reason
+	}
+	return ""
+}
+
+// Returns the first entry that contains the address, or nil if no entry
+// contains the address.
+func matchEntry(entries []filterEntry, ip net.IP) *filterEntry {
+	isIPv4 := ip.To4() != nil
+	for idx := range entries {
+		entry := &entries[idx]
+		// IPv4 addresses are held in IPv4-mapped form and so must not
+		// be compared with IPv6 ranges.
+		if isIPv4 != (len(entry.network.Mask) == net.IPv4len) {
+			continue
+		}
+		if entry.network.Contains(ip) {
+			return entry
+		}
+	}
+	return nil
+}
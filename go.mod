@@ -0,0 +1,16 @@
+module pathspider.net/hellfire
+
+go 1.22
+
+require (
+	github.com/docopt/docopt-go v0.0.0-20180111231733-ee0de3bc6815
+	github.com/google/gopacket v1.1.19
+	github.com/klauspost/compress v1.18.0
+	github.com/ulikunitz/xz v0.5.12
+	golang.org/x/net v0.30.0
+)
+
+require (
+	golang.org/x/sys v0.26.0 // indirect
+	golang.org/x/text v0.19.0 // indirect
+)
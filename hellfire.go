@@ -1,63 +1,36 @@
 package hellfire // import "pathspider.net/hellfire"
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net"
-	"strings"
 	"sync"
 	"time"
 )
 
+// Maps the supported address families to the network names understood by
+// the resolver. Only the record types for the requested family are queried.
+var familyNetworks = map[string]string{
+	"4":    "ip4",
+	"6":    "ip6",
+	"both": "ip",
+}
+
 type LookupQueryResult struct {
 	attempts int
 	result   []net.IP
 }
 
-func prepareTestList(testListOptions string) TestList {
-	var testList TestList
-
-	options := strings.Split(testListOptions, ";")
-
-	if len(options) < 3 {
-		return nil
-	}
-
-	if options[0] == "topsites" {
-		testList = new(AlexaTopsitesList)
-	} else if options[0] == "cisco" {
-		testList = new(CiscoUmbrellaList)
-	} else if options[0] == "citizenlab" {
-		testList = new(CitizenLabCountryList)
-		if options[1] != "" {
-			testList.(*CitizenLabCountryList).SetCountry(options[1])
-		}
-	} else if options[0] == "opendns" {
-		testList = new(OpenDNSList)
-		if options[1] != "" {
-			testList.(*OpenDNSList).SetListName(options[1])
-		}
+// Returns the address family (4 or 6) of an IP address.
+func ipFamily(ip net.IP) int {
+	if ip.To4() != nil {
+		return 4
 	}
-
-	if options[2] != "" {
-		if options[0] == "csv" {
-			testList = CSVListFromFile(options[2])
-		} else if options[0] == "txt" {
-			testList = CSVListFromFile(options[2])
-			testList.(*CSVList).SetHeader([]string{"domain"})
-		} else if testList != nil {
-			testList.SetFilename(options[2])
-		}
-	}
-
-	if testList == nil {
-		panic("Could not initialise a test list!")
-	}
-
-	return testList
+	return 6
 }
 
-func makeQuery(domain string, lookupType string) LookupQueryResult {
+func makeQuery(domain string, lookupType string, family string) LookupQueryResult {
 	result := []net.IP{}
 	domains := []string{}
 	lookupAttempt := 1
@@ -107,7 +80,8 @@ func makeQuery(domain string, lookupType string) LookupQueryResult {
 	for _, d := range domains {
 		var ips []net.IP
 		for {
-			ips, _ = net.LookupIP(d)
+			ips, _ = net.DefaultResolver.LookupIP(context.Background(),
+				familyNetworks[family], d)
 			if len(ips) == 0 {
 				time.Sleep(1)
 			} else {
@@ -124,11 +98,21 @@ func makeQuery(domain string, lookupType string) LookupQueryResult {
 	return LookupQueryResult{lookupAttempt, result}
 }
 
+// Passes a result through each of the filters in turn, returning false as
+// soon as any filter drops it.
+func applyFilters(filters []ResultFilter, result map[string]interface{}, ip net.IP) bool {
+	for _, filter := range filters {
+		if !filter.FilterResult(result, ip) {
+			return false
+		}
+	}
+	return true
+}
+
 func lookupWorker(id int, lookupWaitGroup *sync.WaitGroup,
 	jobs chan map[string]interface{},
 	results chan map[string]interface{},
-	lookupType string,
-	canidAddress string,
+	options LookupOptions,
 	rateLimiter <-chan time.Time) {
 
 	lookupWaitGroup.Add(1)
@@ -137,8 +121,7 @@ func lookupWorker(id int, lookupWaitGroup *sync.WaitGroup,
 		lookupWaitGroup *sync.WaitGroup,
 		jobs chan map[string]interface{},
 		results chan map[string]interface{},
-		lookupType string,
-		canidAddress string) {
+		options LookupOptions) {
 		defer lookupWaitGroup.Done()
 		for job := range jobs {
 			if job["domain"] == nil {
@@ -150,22 +133,26 @@ func lookupWorker(id int, lookupWaitGroup *sync.WaitGroup,
 			<-rateLimiter
 
 			lookupResult := makeQuery(job["domain"].(string),
-				lookupType)
+				options.LookupType, options.Family)
 			job["hellfire_lookup_attempts"] = lookupResult.attempts
-			job["hellfire_lookup_type"] = lookupType
+			job["hellfire_lookup_type"] = options.LookupType
 			for _, ip := range lookupResult.result {
 				thisResult := make(map[string]interface{})
 				for key, value := range job {
 					thisResult[key] = value
 				}
 				thisResult["ips"] = []net.IP{ip}
-				if canidAddress != "" {
-					thisResult["canid_info"] = GetAdditionalInfo(ip, canidAddress)
+				thisResult["family"] = ipFamily(ip)
+				if !applyFilters(options.Filters, thisResult, ip) {
+					continue
+				}
+				if options.CanidAddress != "" {
+					thisResult["canid_info"] = GetAdditionalInfo(ip, options.CanidAddress)
 				}
 				results <- thisResult
 			}
 		}
-	}(id, lookupWaitGroup, jobs, results, lookupType, canidAddress)
+	}(id, lookupWaitGroup, jobs, results, options)
 }
 
 func outputPrinter(outputWaitGroup *sync.WaitGroup, results chan map[string]interface{}, outputType string) {
@@ -200,7 +187,7 @@ func outputPrinter(outputWaitGroup *sync.WaitGroup, results chan map[string]inte
 				delete(result, "ips")
 				for _, ipo := range ips {
 					ip := ipo.String()
-					if strings.Contains(ip, ".") {
+					if ipFamily(ipo) == 4 {
 						if found4 {
 							continue
 						} else {
@@ -223,27 +210,99 @@ func outputPrinter(outputWaitGroup *sync.WaitGroup, results chan map[string]inte
 	}(results)
 }
 
+// LookupOptions holds the options for PerformLookupsContext. Any option left
+// as its zero value takes its default.
+type LookupOptions struct {
+	// The type of lookup: "host", "ns" or "mx" (default "host")
+	LookupType string
+	// The address family to look up: "4", "6" or "both" (default "both")
+	Family string
+	// The output type: "individual", "array" or "oneeach" (default
+	// "individual")
+	OutputType string
+	// The address of a Canid instance for additional information about
+	// addresses, if any
+	CanidAddress string
+	// The rate limit for queries, in queries per second (default 10)
+	QueriesPerSecond int
+	// The filters that results are passed through before output
+	Filters []ResultFilter
+}
+
+// The lookupOptionsFilter interface is implemented by filters that make
+// lookups of their own, which should use the same address family and count
+// towards the same rate limit as the lookups for jobs.
+type lookupOptionsFilter interface {
+	setLookupOptions(options LookupOptions, rateLimiter <-chan time.Time)
+}
+
+// Returns the options with defaults set for any that have not been set.
+func (o LookupOptions) withDefaults() LookupOptions {
+	if o.LookupType == "" {
+		o.LookupType = "host"
+	}
+	if o.Family == "" {
+		o.Family = "both"
+	}
+	if o.OutputType == "" {
+		o.OutputType = "individual"
+	}
+	if o.QueriesPerSecond <= 0 {
+		o.QueriesPerSecond = 10
+	}
+	return o
+}
+
+// The PerformLookups function looks up the jobs from the TestList given by an
+// option string, as for PrepareTestList, and prints the results. It panics if
+// the TestList cannot be created or fed.
+//
+// Deprecated: Use PerformLookupsContext, which takes a TestList and further
+// options, and returns an error in place of panicking.
 func PerformLookups(testListOptions string, lookupType string, outputType string, canidAddress string, queriesPerSecond int) {
+	err := PerformLookupsContext(context.Background(), PrepareTestList(testListOptions), LookupOptions{
+		LookupType:       lookupType,
+		OutputType:       outputType,
+		CanidAddress:     canidAddress,
+		QueriesPerSecond: queriesPerSecond,
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// The PerformLookupsContext function looks up the jobs from a TestList and
+// prints the results. Feeding stops early if the context is cancelled, in
+// which case the lookups for jobs already submitted are completed and output
+// before the error is returned. An error is also returned if feeding the
+// TestList fails.
+func PerformLookupsContext(ctx context.Context, testList TestList, options LookupOptions) error {
+	options = options.withDefaults()
 	var lookupWaitGroup sync.WaitGroup
 	var outputWaitGroup sync.WaitGroup
 
 	jobs := make(chan map[string]interface{}, 1)
 	results := make(chan map[string]interface{})
-	testList := prepareTestList(testListOptions)
 
 	// Create a rate limiting ticker
-	rateLimiter := time.Tick(time.Second / time.Duration(queriesPerSecond))
+	rateLimiter := time.Tick(time.Second / time.Duration(options.QueriesPerSecond))
+
+	for _, filter := range options.Filters {
+		if f, ok := filter.(lookupOptionsFilter); ok {
+			f.setLookupOptions(options, rateLimiter)
+		}
+	}
 
 	// Spawn lookup workers
 	for i := 0; i < 300; i++ {
-		lookupWorker(i, &lookupWaitGroup, jobs, results, lookupType, canidAddress, rateLimiter)
+		lookupWorker(i, &lookupWaitGroup, jobs, results, options, rateLimiter)
 	}
 
 	// Spawn output printer
-	outputPrinter(&outputWaitGroup, results, outputType)
+	outputPrinter(&outputWaitGroup, results, options.OutputType)
 
 	// Submit jobs
-	testList.FeedJobs(jobs)
+	err := AsFeeder(testList).Feed(ctx, jobs)
 	jobs <- make(map[string]interface{})
 	lookupWaitGroup.Wait()
 	<-jobs // Read last shutdown sentinel from the queue left by the
@@ -255,4 +314,6 @@ func PerformLookups(testListOptions string, lookupType string, outputType string
 	results <- make(map[string]interface{})
 	outputWaitGroup.Wait()
 	close(results)
+
+	return err
 }
@@ -0,0 +1,127 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// A JSONList handles input in JSON format. The input may be either NDJSON,
+// with one job object per line, or a single JSON array of job objects. All
+// fields of each object are passed through as job metadata. Each object must
+// have either a "domain" string or a "url" string with a host, and reading
+// fails at the first object that does not. Input compressed with gzip, bzip2,
+// xz, zstd or zip is decompressed transparently.
+type JSONList struct {
+	TestList
+	reader io.Reader
+}
+
+func init() {
+	RegisterSource(Source{
+		Name: "json",
+		New: func(options map[string]string) (TestList, error) {
+			if err := requireFile("json", options); err != nil {
+				return nil, err
+			}
+			return OpenJSONList(options[FileOption])
+		},
+	})
+}
+
+// The JSONListFromFile function creates a JSONList reading from the named file,
+// or from standard input if the filename is "-". It panics if the file cannot
+// be opened; OpenJSONList returns an error instead.
+func JSONListFromFile(filename string) *JSONList {
+	l, err := OpenJSONList(filename)
+	if err != nil {
+		panic("Error opening file")
+	}
+	return l
+}
+
+// The OpenJSONList function creates a JSONList reading from the named file,
+// or from standard input if the filename is "-".
+func OpenJSONList(filename string) (*JSONList, error) {
+	f, err := openFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return JSONListFromReader(f), nil
+}
+
+func JSONListFromReader(reader io.Reader) *JSONList {
+	l := new(JSONList)
+	l.reader = reader
+	return l
+}
+
+func (l *JSONList) FeedJobs(jobs chan map[string]interface{}) {
+	feedJobs(l, jobs)
+}
+
+func (l *JSONList) Feed(ctx context.Context, jobs chan map[string]interface{}) error {
+	if l.reader == nil {
+		return errors.New("JSONList not initialised with a reader")
+	}
+	decompressed, err := decompressReader(l.reader)
+	if err != nil {
+		return fmt.Errorf("error decompressing the JSON: %s", err)
+	}
+	reader := bufio.NewReader(decompressed)
+
+	// Skip leading whitespace to find whether this is an array
+	isArray := false
+	for {
+		b, err := reader.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading the JSON: %s", err)
+		}
+		if b == ' ' || b == '\t' || b == '\r' || b == '\n' {
+			continue
+		}
+		isArray = b == '['
+		reader.UnreadByte()
+		break
+	}
+
+	decoder := json.NewDecoder(reader)
+	decoder.UseNumber()
+	if isArray {
+		// Consume the opening bracket of the array
+		decoder.Token()
+	}
+	index := 0
+	for {
+		if isArray && !decoder.More() {
+			break
+		}
+		index++
+		var job map[string]interface{}
+		err := decoder.Decode(&job)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading the JSON: %s", err)
+		}
+		if job == nil {
+			continue
+		}
+		setDomainFromURL(job)
+		if domain, ok := job["domain"].(string); !ok || domain == "" {
+			return fmt.Errorf("error reading the JSON: object %d: missing a domain or a URL with a host", index)
+		}
+		err = sendJob(ctx, jobs, job)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
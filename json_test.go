@@ -0,0 +1,74 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONList(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []map[string]interface{}
+	}{
+		{
+			name:  "array",
+			input: `[{"domain": "example.com", "rank": 1}, {"domain": "example.net"}]`,
+			want: []map[string]interface{}{
+				{"domain": "example.com", "rank": json.Number("1")},
+				{"domain": "example.net"},
+			},
+		},
+		{
+			name:  "lines",
+			input: "{\"domain\": \"example.com\"}\n\n{\"url\": \"https://example.net/a\"}\n",
+			want: []map[string]interface{}{
+				{"domain": "example.com"},
+				{"url": "https://example.net/a", "domain": "example.net"},
+			},
+		},
+		{
+			name:  "null",
+			input: `[null, {"domain": "example.com"}]`,
+			want:  []map[string]interface{}{{"domain": "example.com"}},
+		},
+		{
+			name:  "empty",
+			input: "  \n",
+		},
+		{
+			name:  "empty array",
+			input: "[]",
+		},
+	}
+	for _, test := range tests {
+		got, err := collectJobs(JSONListFromReader(strings.NewReader(test.input)))
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		} else if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestJSONListMissingDomain(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		error string
+	}{
+		{"no domain", `[{"domain": "example.com"}, {"foo": 1}]`, "object 2: missing a domain"},
+		{"domain not a string", `{"domain": 5}`, "object 1: missing a domain"},
+		{"empty domain", `{"domain": ""}`, "object 1: missing a domain"},
+		{"url without a host", `{"url": "file:///etc/hosts"}`, "object 1: missing a domain"},
+		{"invalid", `[{"domain": "example.com"}, {`, "error reading the JSON"},
+	}
+	for _, test := range tests {
+		_, err := collectJobs(JSONListFromReader(strings.NewReader(test.input)))
+		if err == nil || !strings.Contains(err.Error(), test.error) {
+			t.Errorf("%s: got error %v, want one containing %q", test.name, err, test.error)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"context"
+	"fmt"
+)
+
+type MajesticMillionList struct {
+	TestList
+	filename string
+}
+
+// URL to download the latest Majestic Million list from
+const MajesticMillionURL string = "https://downloads.majestic.com/majestic_million.csv"
+
+func init() {
+	RegisterSource(Source{
+		Name: "majestic",
+		New: func(options map[string]string) (TestList, error) {
+			l := new(MajesticMillionList)
+			l.SetFilename(options[FileOption])
+			return l, nil
+		},
+	})
+}
+
+func (l *MajesticMillionList) SetFilename(filename string) {
+	l.filename = filename
+}
+
+func (l *MajesticMillionList) FeedJobs(jobs chan map[string]interface{}) {
+	feedJobs(l, jobs)
+}
+
+// The Feed method submits a job for each domain in the list. The
+// "GlobalRank" and "Domain" columns of the list are mapped to the "rank" and
+// "domain" fields of the job, and all other columns are passed through.
+func (l *MajesticMillionList) Feed(ctx context.Context, jobs chan map[string]interface{}) error {
+	var majesticList *CSVList
+
+	if l.filename == "" {
+		urlReader, source, err := getReaderFromSource("majestic")
+		if err != nil {
+			return fmt.Errorf("unable to get <%s>: %s", source, err)
+		}
+
+		majesticList = CSVListFromReader(urlReader)
+	} else {
+		var err error
+		majesticList, err = OpenCSVList(l.filename)
+		if err != nil {
+			return err
+		}
+	}
+
+	return feedThrough(ctx, majesticList, func(job map[string]interface{}) error {
+		job["rank"] = job["GlobalRank"]
+		job["domain"] = job["Domain"]
+		delete(job, "GlobalRank")
+		delete(job, "Domain")
+		return sendJob(ctx, jobs, job)
+	})
+}
@@ -0,0 +1,66 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// A MetadataList wraps another TestList and adds a fixed set of fields to
+// every job, such as a campaign identifier for the run. Fields that a job
+// already has, including "domain" and "url", are not replaced.
+type MetadataList struct {
+	TestList
+	metadata map[string]interface{}
+}
+
+func NewMetadataList(testList TestList) *MetadataList {
+	l := new(MetadataList)
+	l.TestList = testList
+	l.metadata = make(map[string]interface{})
+	return l
+}
+
+// The Set method sets a field to be added to every job, replacing any value
+// set previously for the same field.
+func (l *MetadataList) Set(key string, value interface{}) {
+	l.metadata[key] = value
+}
+
+// The LoadFile method sets the fields of a JSON object read from a file to be
+// added to every job.
+func (l *MetadataList) LoadFile(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var metadata map[string]interface{}
+	decoder := json.NewDecoder(file)
+	decoder.UseNumber()
+	err = decoder.Decode(&metadata)
+	if err != nil {
+		return fmt.Errorf("%s: %s", filename, err)
+	}
+	for key, value := range metadata {
+		l.Set(key, value)
+	}
+	return nil
+}
+
+func (l *MetadataList) FeedJobs(jobs chan map[string]interface{}) {
+	feedJobs(l, jobs)
+}
+
+func (l *MetadataList) Feed(ctx context.Context, jobs chan map[string]interface{}) error {
+	return feedThrough(ctx, l.TestList, func(job map[string]interface{}) error {
+		for key, value := range l.metadata {
+			if _, ok := job[key]; !ok {
+				job[key] = value
+			}
+		}
+		return sendJob(ctx, jobs, job)
+	})
+}
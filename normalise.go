@@ -0,0 +1,108 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// The IDNA profile used to normalise names. This applies the UTS #46 mapping
+// for lookup, without transitional processing, so that names are converted to
+// lowercase A-labels as IDNA2008 requires, and checks the lengths of the
+// labels and of the whole name. The STD3 and hyphen rules are not applied, as
+// names such as _dmarc.example.com or foo-.example.com are found in DNS and
+// in test lists, so NormaliseDomain checks the ASCII characters itself.
+var normaliseProfile = idna.New(
+	idna.MapForLookup(),
+	idna.StrictDomainName(false),
+	idna.CheckHyphens(false),
+	idna.BidiRule(),
+	idna.Transitional(false),
+	idna.VerifyDNSLength(true),
+)
+
+// The NormaliseDomain function returns the lowercase A-label form of a domain
+// name, with surrounding whitespace and any trailing dot removed. IP address
+// literals are returned unchanged. An error giving the reason is returned if
+// the name is not a valid domain name. Labels may contain letters, digits,
+// hyphens and underscores.
+func NormaliseDomain(domain string) (string, error) {
+	domain = strings.TrimSuffix(strings.TrimSpace(domain), ".")
+	if domain == "" {
+		return "", errors.New("empty name")
+	}
+	if net.ParseIP(domain) != nil {
+		return domain, nil
+	}
+	normalised, err := normaliseProfile.ToASCII(domain)
+	if err != nil {
+		return "", err
+	}
+	for _, c := range normalised {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return "", fmt.Errorf("invalid character %q", c)
+		}
+	}
+	// An ASCII name only changes case, unless it holds an A-label that
+	// does not decode to a U-label
+	if isASCII(domain) && normalised != strings.ToLower(domain) {
+		return "", fmt.Errorf("invalid A-label in %q", domain)
+	}
+	return normalised, nil
+}
+
+// Returns true if a string contains only ASCII characters.
+func isASCII(s string) bool {
+	for idx := 0; idx < len(s); idx++ {
+		if s[idx] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// A DomainNormaliser wraps another TestList and normalises the domain of each
+// job with NormaliseDomain before it is looked up. Where the input name was
+// given in Unicode, as for internationalised domain names, it is kept as it
+// was given in the "hellfire_unicode_domain" field. Names given as A-labels
+// are not converted to Unicode. Jobs without a valid domain are logged with
+// the reason and are not submitted.
+type DomainNormaliser struct {
+	TestList
+}
+
+func NewDomainNormaliser(testList TestList) *DomainNormaliser {
+	n := new(DomainNormaliser)
+	n.TestList = testList
+	return n
+}
+
+func (n *DomainNormaliser) FeedJobs(jobs chan map[string]interface{}) {
+	feedJobs(n, jobs)
+}
+
+func (n *DomainNormaliser) Feed(ctx context.Context, jobs chan map[string]interface{}) error {
+	return feedThrough(ctx, n.TestList, func(job map[string]interface{}) error {
+		domain, ok := job["domain"].(string)
+		if !ok {
+			log.Printf("Rejecting job without a domain: %v", job)
+			return nil
+		}
+		normalised, err := NormaliseDomain(domain)
+		if err != nil {
+			log.Printf("Rejecting invalid name %q: %s", domain, err)
+			return nil
+		}
+		if !isASCII(domain) {
+			job["hellfire_unicode_domain"] = strings.TrimSuffix(strings.TrimSpace(domain), ".")
+		}
+		job["domain"] = normalised
+		return sendJob(ctx, jobs, job)
+	})
+}
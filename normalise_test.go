@@ -0,0 +1,75 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormaliseDomain(t *testing.T) {
+	tests := []struct {
+		domain string
+		want   string
+	}{
+		{"example.com", "example.com"},
+		{" Example.COM. ", "example.com"},
+		{"192.0.2.1", "192.0.2.1"},
+		{"2001:db8::1", "2001:db8::1"},
+		// Underscores, as in service and DMARC names
+		{"foo_bar.example.com", "foo_bar.example.com"},
+		{"_dmarc.example.com", "_dmarc.example.com"},
+		{"_sip._tcp.example.com", "_sip._tcp.example.com"},
+		// Hyphens
+		{"foo-bar.example.com", "foo-bar.example.com"},
+		{"-foo.example.com", "-foo.example.com"},
+		{"foo-.example.com", "foo-.example.com"},
+		{"ab--cd.example.com", "ab--cd.example.com"},
+		{"1-2-3.example", "1-2-3.example"},
+		// Internationalised names
+		{"Bücher.de", "xn--bcher-kva.de"},
+		{"xn--bcher-kva.de", "xn--bcher-kva.de"},
+		{"XN--BCHER-KVA.DE", "xn--bcher-kva.de"},
+		// Invalid names
+		{"", ""},
+		{".", ""},
+		{"a..b", ""},
+		{"foo bar.com", ""},
+		{"foo/bar.com", ""},
+		{"*.example.com", ""},
+		{"xn--zz.de", ""},
+		{"xn--abc-.de", ""},
+		{strings.Repeat("a", 64) + ".com", ""},
+	}
+	for _, test := range tests {
+		got, err := NormaliseDomain(test.domain)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("NormaliseDomain(%q): got %q, want an error", test.domain, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NormaliseDomain(%q): %s", test.domain, err)
+		} else if got != test.want {
+			t.Errorf("NormaliseDomain(%q): got %q, want %q", test.domain, got, test.want)
+		}
+	}
+}
+
+func TestDomainNormaliser(t *testing.T) {
+	input := "domain\nBücher.de\nxn--bcher-kva.de\n Example.COM.\n_dmarc.example.com\nfoo bar.com\nmünchen.de.\n"
+	got, err := collectJobs(NewDomainNormaliser(CSVListFromReader(strings.NewReader(input))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]interface{}{
+		{"domain": "xn--bcher-kva.de", "hellfire_unicode_domain": "Bücher.de"},
+		{"domain": "xn--bcher-kva.de"},
+		{"domain": "example.com"},
+		{"domain": "_dmarc.example.com"},
+		{"domain": "xn--mnchen-3ya.de", "hellfire_unicode_domain": "münchen.de"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
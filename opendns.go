@@ -1,21 +1,51 @@
 package hellfire // import "pathspider.net/hellfire"
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"strings"
 )
 
 type OpenDNSList struct {
 	TestList
+	gitSource
 	listname string
 	filename string
 }
 
-// URL format string to download the OpenDNS public domain list from. The %s
-// will be replaced with the name of the list as specified in the call to
-// SetListName before the job feeder is activated.
-const OpenDNSListURL string = "https://raw.githubusercontent.com/opendns/public-domain-lists/master/opendns-%s-domains.txt"
+// URL format string to download the OpenDNS public domain list from. The
+// first %s will be replaced with the revision of the repository, which is
+// "master" unless the list has been pinned with SetRevision or SetDate. The
+// second %s will be replaced with the name of the list as specified in the
+// call to SetListName before the job feeder is activated.
+const OpenDNSListURL string = "https://raw.githubusercontent.com/opendns/public-domain-lists/%s/opendns-%s-domains.txt"
+
+// GitHub repository and branch holding the OpenDNS public domain lists
+const (
+	OpenDNSRepository string = "opendns/public-domain-lists"
+	OpenDNSBranch     string = "master"
+)
+
+func init() {
+	RegisterSource(Source{
+		Name:    "opendns",
+		Options: append([]string{"list"}, revisionOptions...),
+		Variant: "list",
+		New: func(options map[string]string) (TestList, error) {
+			l := new(OpenDNSList)
+			if options["list"] != "" {
+				l.SetListName(options["list"])
+			} else {
+				l.SetListName("top")
+			}
+			setRevisionOptions(l, options)
+			l.SetFilename(options[FileOption])
+			return l, nil
+		},
+	})
+}
 
 func (l *OpenDNSList) SetFilename(filename string) {
 	l.filename = filename
@@ -35,22 +65,43 @@ func (l *OpenDNSList) SetListName(listname string) {
 }
 
 func (l *OpenDNSList) FeedJobs(jobs chan map[string]interface{}) {
+	feedJobs(l, jobs)
+}
+
+// The Feed method submits a job for each domain in the list. The revision of
+// the repository that the list was read from is recorded in the
+// "opendns_revision" field of the job.
+func (l *OpenDNSList) Feed(ctx context.Context, jobs chan map[string]interface{}) error {
 	var openDNSList *CSVList
+	var revision string
 
 	if l.filename == "" {
 		if l.listname == "" {
-			panic("The list name to use was not specified.")
+			return errors.New("the list name to use was not specified")
 		}
-		listUrl := fmt.Sprintf(OpenDNSListURL, l.listname)
-		urlReader, err := getReaderFromUrl(listUrl)
+		listPath := fmt.Sprintf("opendns-%s-domains.txt", l.listname)
+		urlReader, source, listRevision, err := l.getReader(OpenDNSRepository,
+			OpenDNSBranch, listPath, func(revision string) (*bytes.Reader, string, error) {
+				return getReaderFromSource("opendns", revision, l.listname)
+			})
 		if err != nil {
-			log.Fatalf("Unable to get <%s>: %s", listUrl, err)
+			return fmt.Errorf("unable to get <%s>: %s", source, err)
 		}
 
 		openDNSList = CSVListFromReader(urlReader)
+		revision = listRevision
 	} else {
-		openDNSList = CSVListFromFile(l.filename)
+		var err error
+		openDNSList, err = OpenCSVList(l.filename)
+		if err != nil {
+			return err
+		}
 	}
 	openDNSList.SetHeader([]string{"domain"})
-	openDNSList.FeedJobs(jobs)
+	return feedThrough(ctx, openDNSList, func(job map[string]interface{}) error {
+		if revision != "" {
+			job["opendns_revision"] = revision
+		}
+		return sendJob(ctx, jobs, job)
+	})
 }
@@ -0,0 +1,282 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// The magic number at the start of a pcapng file
+var pcapngMagic = []byte{0x0a, 0x0d, 0x0d, 0x0a}
+
+// A PcapList extracts names from traffic in a packet capture, in either pcap
+// or pcapng format. Names are taken from the questions of DNS messages sent
+// over UDP, from the Server Name Indication of TLS ClientHellos, and from the
+// Host header of HTTP requests. Each name is submitted once, the first time
+// it is seen, with the protocol it was seen in given in the
+// "hellfire_pcap_protocol" field as "dns", "tls" or "http". For TLS and HTTP,
+// the destination port is given in the "port" field.
+//
+// TCP streams are not reassembled, so a ClientHello or HTTP request is only
+// found if it starts at the beginning of a segment and, for TLS, the server
+// name is within that segment. Reverse lookups under "arpa" are ignored.
+type PcapList struct {
+	TestList
+	reader io.Reader
+}
+
+func init() {
+	RegisterSource(Source{
+		Name: "pcap",
+		New: func(options map[string]string) (TestList, error) {
+			if err := requireFile("pcap", options); err != nil {
+				return nil, err
+			}
+			return OpenPcapList(options[FileOption])
+		},
+	})
+}
+
+// The OpenPcapList function creates a PcapList reading from the named file,
+// or from standard input if the filename is "-".
+func OpenPcapList(filename string) (*PcapList, error) {
+	f, err := openFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return PcapListFromReader(f), nil
+}
+
+func PcapListFromReader(reader io.Reader) *PcapList {
+	l := new(PcapList)
+	l.reader = reader
+	return l
+}
+
+// The interface shared by the pcap and pcapng readers
+type packetReader interface {
+	gopacket.PacketDataSource
+	LinkType() layers.LinkType
+}
+
+func (l *PcapList) FeedJobs(jobs chan map[string]interface{}) {
+	feedJobs(l, jobs)
+}
+
+// The Feed method submits a job for each name found in the capture. Captures
+// compressed with gzip, bzip2, xz, zstd or zip are decompressed transparently.
+func (l *PcapList) Feed(ctx context.Context, jobs chan map[string]interface{}) error {
+	if l.reader == nil {
+		return errors.New("PcapList not initialised with a reader")
+	}
+	decompressed, err := decompressReader(l.reader)
+	if err != nil {
+		return fmt.Errorf("error decompressing the capture: %s", err)
+	}
+	buffered := bufio.NewReader(decompressed)
+	magic, _ := buffered.Peek(len(pcapngMagic))
+
+	var reader packetReader
+	if bytes.Equal(magic, pcapngMagic) {
+		reader, err = pcapgo.NewNgReader(buffered, pcapgo.DefaultNgReaderOptions)
+	} else {
+		reader, err = pcapgo.NewReader(buffered)
+	}
+	if err != nil {
+		return fmt.Errorf("error reading the capture: %s", err)
+	}
+
+	seen := make(map[string]bool)
+	for {
+		data, _, err := reader.ReadPacketData()
+		if err == io.EOF {
+			break
+		}
+		if err == io.ErrUnexpectedEOF {
+			log.Printf("Capture is truncated, ignoring the last packet")
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading the capture: %s", err)
+		}
+		packet := gopacket.NewPacket(data, reader.LinkType(), gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+		for _, job := range packetJobs(packet) {
+			domain := strings.ToLower(strings.TrimSuffix(job["domain"].(string), "."))
+			if domain == "" || seen[domain] || domain == "arpa" || strings.HasSuffix(domain, ".arpa") {
+				continue
+			}
+			seen[domain] = true
+			err = sendJob(ctx, jobs, job)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Returns a job for each name found in a packet.
+func packetJobs(packet gopacket.Packet) []map[string]interface{} {
+	var found []map[string]interface{}
+
+	if dnsLayer := packet.Layer(layers.LayerTypeDNS); dnsLayer != nil {
+		if _, ok := packet.TransportLayer().(*layers.UDP); ok {
+			for _, question := range dnsLayer.(*layers.DNS).Questions {
+				found = append(found, map[string]interface{}{
+					"domain":                 string(question.Name),
+					"hellfire_pcap_protocol": "dns",
+				})
+			}
+		}
+		return found
+	}
+
+	tcp, ok := packet.TransportLayer().(*layers.TCP)
+	if !ok || len(tcp.Payload) == 0 {
+		return found
+	}
+	if name := tlsServerName(tcp.Payload); name != "" {
+		found = append(found, map[string]interface{}{
+			"domain":                 name,
+			"port":                   int(tcp.DstPort),
+			"hellfire_pcap_protocol": "tls",
+		})
+	} else if host := httpHost(tcp.Payload); host != "" {
+		found = append(found, map[string]interface{}{
+			"domain":                 host,
+			"port":                   int(tcp.DstPort),
+			"hellfire_pcap_protocol": "http",
+		})
+	}
+	return found
+}
+
+// Returns the host name from the Server Name Indication extension of a TLS
+// ClientHello at the start of a payload, or an empty string if there is none.
+func tlsServerName(payload []byte) string {
+	// TLS record header: handshake content type, version and length
+	if len(payload) < 5 || payload[0] != 0x16 || payload[1] != 0x03 {
+		return ""
+	}
+	p := payload[5:]
+	// Handshake header: ClientHello type and length
+	if len(p) < 4 || p[0] != 0x01 {
+		return ""
+	}
+	p = p[4:]
+	// Client version and random
+	if len(p) < 34 {
+		return ""
+	}
+	p = p[34:]
+	// Session ID, cipher suites and compression methods
+	var ok bool
+	if p, ok = skipVector(p, 1); !ok {
+		return ""
+	}
+	if p, ok = skipVector(p, 2); !ok {
+		return ""
+	}
+	if p, ok = skipVector(p, 1); !ok {
+		return ""
+	}
+	if len(p) < 2 {
+		return ""
+	}
+	extensions := p[2:]
+	if extensionsLength := int(binary.BigEndian.Uint16(p)); extensionsLength < len(extensions) {
+		extensions = extensions[:extensionsLength]
+	}
+	for len(extensions) >= 4 {
+		extensionType := binary.BigEndian.Uint16(extensions)
+		extensionLength := int(binary.BigEndian.Uint16(extensions[2:]))
+		if len(extensions) < 4+extensionLength {
+			return ""
+		}
+		data := extensions[4 : 4+extensionLength]
+		extensions = extensions[4+extensionLength:]
+		if extensionType != 0 {
+			continue
+		}
+		// Server name list, holding entries of a name type and a name
+		if len(data) < 2 {
+			return ""
+		}
+		names := data[2:]
+		for len(names) >= 3 {
+			nameType := names[0]
+			nameLength := int(binary.BigEndian.Uint16(names[1:]))
+			if len(names) < 3+nameLength {
+				return ""
+			}
+			if nameType == 0 {
+				return string(names[3 : 3+nameLength])
+			}
+			names = names[3+nameLength:]
+		}
+		return ""
+	}
+	return ""
+}
+
+// Skips a vector with a length prefix of the given number of bytes, returning
+// the remainder and false if the vector is truncated.
+func skipVector(p []byte, lengthBytes int) ([]byte, bool) {
+	if len(p) < lengthBytes {
+		return nil, false
+	}
+	length := 0
+	for _, b := range p[:lengthBytes] {
+		length = length<<8 | int(b)
+	}
+	if len(p) < lengthBytes+length {
+		return nil, false
+	}
+	return p[lengthBytes+length:], true
+}
+
+// The request methods that identify the start of an HTTP request
+var httpMethods = []string{"GET ", "POST ", "HEAD ", "PUT ", "DELETE ",
+	"OPTIONS ", "PATCH ", "CONNECT ", "TRACE "}
+
+// Returns the host from the Host header of an HTTP request at the start of a
+// payload, without any port, or an empty string if there is none.
+func httpHost(payload []byte) string {
+	isRequest := false
+	for _, method := range httpMethods {
+		if bytes.HasPrefix(payload, []byte(method)) {
+			isRequest = true
+			break
+		}
+	}
+	if !isRequest {
+		return ""
+	}
+	headers := payload
+	if end := bytes.Index(payload, []byte("\r\n\r\n")); end >= 0 {
+		headers = payload[:end]
+	}
+	for _, line := range strings.Split(string(headers), "\r\n")[1:] {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || !strings.EqualFold(strings.TrimSpace(name), "host") {
+			continue
+		}
+		host := strings.TrimSpace(value)
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		return host
+	}
+	return ""
+}
@@ -0,0 +1,271 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// Returns the first TLS record written by a client connecting with a server
+// name, i.e. its ClientHello.
+func clientHello(t *testing.T, serverName string) []byte {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		config := &tls.Config{ServerName: serverName, InsecureSkipVerify: true}
+		tls.Client(client, config).Handshake()
+		client.Close()
+	}()
+
+	buf := make([]byte, 65536)
+	n, err := server.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	return buf[:n]
+}
+
+// Returns a TLS record holding a ClientHello with the given extensions.
+func buildClientHello(extensions ...[]byte) []byte {
+	var body []byte
+	body = append(body, 0x03, 0x03)
+	body = append(body, make([]byte, 32)...)
+	body = append(body, 4, 1, 2, 3, 4)
+	body = append(body, 0, 4, 0x13, 0x01, 0x13, 0x02)
+	body = append(body, 1, 0)
+	var all []byte
+	for _, extension := range extensions {
+		all = append(all, extension...)
+	}
+	body = binary.BigEndian.AppendUint16(body, uint16(len(all)))
+	body = append(body, all...)
+
+	handshake := []byte{0x01, 0, byte(len(body) >> 8), byte(len(body))}
+	handshake = append(handshake, body...)
+	record := []byte{0x16, 0x03, 0x01}
+	record = binary.BigEndian.AppendUint16(record, uint16(len(handshake)))
+	return append(record, handshake...)
+}
+
+// Returns an extension of the given type and data.
+func buildExtension(extensionType uint16, data []byte) []byte {
+	extension := binary.BigEndian.AppendUint16(nil, extensionType)
+	extension = binary.BigEndian.AppendUint16(extension, uint16(len(data)))
+	return append(extension, data...)
+}
+
+// Returns a Server Name Indication extension with entries of the given name
+// types and names.
+func buildServerName(nameTypes []byte, names ...string) []byte {
+	var list []byte
+	for idx, name := range names {
+		list = append(list, nameTypes[idx])
+		list = binary.BigEndian.AppendUint16(list, uint16(len(name)))
+		list = append(list, name...)
+	}
+	data := binary.BigEndian.AppendUint16(nil, uint16(len(list)))
+	return buildExtension(0, append(data, list...))
+}
+
+func TestTLSServerName(t *testing.T) {
+	supportedGroups := buildExtension(10, []byte{0, 2, 0, 29})
+	hello := buildClientHello(supportedGroups, buildServerName([]byte{0}, "example.com"))
+
+	tests := []struct {
+		name    string
+		payload []byte
+		want    string
+	}{
+		{"crypto/tls", clientHello(t, "www.example.com"), "www.example.com"},
+		{"crypto/tls without a server name", clientHello(t, ""), ""},
+		{"server name last", hello, "example.com"},
+		{"server name first", buildClientHello(buildServerName([]byte{0}, "example.com"), supportedGroups), "example.com"},
+		{"no extensions", buildClientHello(), ""},
+		{"other extensions only", buildClientHello(supportedGroups), ""},
+		{"unknown name type first", buildClientHello(buildServerName([]byte{1, 0}, "ignored", "example.com")), "example.com"},
+		{"unknown name type only", buildClientHello(buildServerName([]byte{1}, "ignored")), ""},
+		{"application data", append([]byte{0x17}, hello[1:]...), ""},
+		{"server hello", append(append(append([]byte{}, hello[:5]...), 0x02), hello[6:]...), ""},
+		{"http", []byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"), ""},
+		{"empty", nil, ""},
+	}
+	for _, test := range tests {
+		got := tlsServerName(test.payload)
+		if got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	// A ClientHello truncated anywhere before the end of the server name must
+	// not be read past its end or give a partial name
+	for length := 0; length < len(hello); length++ {
+		if got := tlsServerName(hello[:length]); got != "" {
+			t.Errorf("truncated to %d of %d bytes: got %q, want \"\"", length, len(hello), got)
+		}
+	}
+}
+
+func TestHTTPHost(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    string
+	}{
+		{"GET / HTTP/1.1\r\nHost: example.com\r\n\r\n", "example.com"},
+		{"POST /x HTTP/1.1\r\nUser-Agent: a\r\nhost:  Example.com:8080 \r\n\r\n", "Example.com"},
+		{"GET / HTTP/1.1\r\nHost: [2001:db8::1]:80\r\n\r\n", "2001:db8::1"},
+		{"GET / HTTP/1.1\r\nHost: example.com", "example.com"},
+		{"GET / HTTP/1.1\r\nX-Host: example.com\r\n\r\n", ""},
+		{"GET / HTTP/1.1\r\n\r\nHost: example.com\r\n", ""},
+		{"HTTP/1.1 200 OK\r\nHost: example.com\r\n\r\n", ""},
+		{"GETX / HTTP/1.1\r\nHost: example.com\r\n\r\n", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		got := httpHost([]byte(test.payload))
+		if got != test.want {
+			t.Errorf("httpHost(%q): got %q, want %q", test.payload, got, test.want)
+		}
+	}
+}
+
+// Returns an Ethernet frame holding an IPv4 packet with the given transport
+// layer and payload.
+func buildPacket(t *testing.T, transport gopacket.SerializableLayer, payload gopacket.SerializableLayer) []byte {
+	ethernet := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0x02, 0, 0, 0, 0, 1},
+		DstMAC:       net.HardwareAddr{0x02, 0, 0, 0, 0, 2},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{
+		Version: 4,
+		TTL:     64,
+		SrcIP:   net.IP{192, 0, 2, 1},
+		DstIP:   net.IP{198, 51, 100, 1},
+	}
+	switch transport := transport.(type) {
+	case *layers.UDP:
+		ip.Protocol = layers.IPProtocolUDP
+		transport.SetNetworkLayerForChecksum(ip)
+	case *layers.TCP:
+		ip.Protocol = layers.IPProtocolTCP
+		transport.SetNetworkLayerForChecksum(ip)
+	}
+	buf := gopacket.NewSerializeBuffer()
+	options := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	err := gopacket.SerializeLayers(buf, options, ethernet, ip, transport, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Returns a packet holding a DNS query over UDP with the given questions.
+func dnsQueryPacket(t *testing.T, names ...string) []byte {
+	dns := &layers.DNS{ID: 1, RD: true}
+	for _, name := range names {
+		dns.Questions = append(dns.Questions, layers.DNSQuestion{
+			Name:  []byte(name),
+			Type:  layers.DNSTypeA,
+			Class: layers.DNSClassIN,
+		})
+	}
+	return buildPacket(t, &layers.UDP{SrcPort: 53000, DstPort: 53}, dns)
+}
+
+// Returns a packet holding a TCP segment to the given port with a payload.
+func tcpPacket(t *testing.T, port int, payload []byte) []byte {
+	tcp := &layers.TCP{SrcPort: 40000, DstPort: layers.TCPPort(port), PSH: true, ACK: true, Window: 65535}
+	return buildPacket(t, tcp, gopacket.Payload(payload))
+}
+
+// Returns the packets of a capture exercising each protocol, with repeated and
+// reverse lookup names.
+func capturePackets(t *testing.T) [][]byte {
+	return [][]byte{
+		dnsQueryPacket(t, "example.com", "www.example.com"),
+		dnsQueryPacket(t, "Example.COM.", "1.2.0.192.in-addr.arpa", "arpa"),
+		dnsQueryPacket(t, "b.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa."),
+		tcpPacket(t, 443, buildClientHello(buildServerName([]byte{0}, "tls.example.org"))),
+		tcpPacket(t, 8080, []byte("GET / HTTP/1.1\r\nHost: http.example.net:8080\r\n\r\n")),
+		tcpPacket(t, 80, []byte("GET / HTTP/1.1\r\nHost: www.example.com\r\n\r\n")),
+		tcpPacket(t, 443, []byte("not a request")),
+		dnsQueryPacket(t, "tls.example.org"),
+	}
+}
+
+// The jobs expected from the packets returned by capturePackets
+var captureJobs = []map[string]interface{}{
+	{"domain": "example.com", "hellfire_pcap_protocol": "dns"},
+	{"domain": "www.example.com", "hellfire_pcap_protocol": "dns"},
+	{"domain": "tls.example.org", "port": 443, "hellfire_pcap_protocol": "tls"},
+	{"domain": "http.example.net", "port": 8080, "hellfire_pcap_protocol": "http"},
+}
+
+// Returns the capture information for a packet captured in full.
+func captureInfo(packet []byte) gopacket.CaptureInfo {
+	return gopacket.CaptureInfo{
+		Timestamp:     time.Unix(1500000000, 0),
+		CaptureLength: len(packet),
+		Length:        len(packet),
+	}
+}
+
+func TestPcapListFeed(t *testing.T) {
+	writers := []struct {
+		format string
+		write  func(*bytes.Buffer, [][]byte) error
+	}{
+		{"pcap", func(buf *bytes.Buffer, packets [][]byte) error {
+			w := pcapgo.NewWriter(buf)
+			err := w.WriteFileHeader(65536, layers.LinkTypeEthernet)
+			if err != nil {
+				return err
+			}
+			for _, packet := range packets {
+				err = w.WritePacket(captureInfo(packet), packet)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{"pcapng", func(buf *bytes.Buffer, packets [][]byte) error {
+			w, err := pcapgo.NewNgWriter(buf, layers.LinkTypeEthernet)
+			if err != nil {
+				return err
+			}
+			for _, packet := range packets {
+				err = w.WritePacket(captureInfo(packet), packet)
+				if err != nil {
+					return err
+				}
+			}
+			return w.Flush()
+		}},
+	}
+
+	packets := capturePackets(t)
+	for _, writer := range writers {
+		var buf bytes.Buffer
+		err := writer.write(&buf, packets)
+		if err != nil {
+			t.Fatalf("%s: %s", writer.format, err)
+		}
+		got, err := collectJobs(PcapListFromReader(&buf))
+		if err != nil {
+			t.Fatalf("%s: %s", writer.format, err)
+		}
+		if !reflect.DeepEqual(got, captureJobs) {
+			t.Errorf("%s: got %v, want %v", writer.format, got, captureJobs)
+		}
+	}
+}
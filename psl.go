@@ -0,0 +1,162 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+// The PublicSuffixList interface describes a list of public suffixes, such
+// as "com" or "co.uk", under which names can be registered. The
+// publicsuffix.List shipped with golang.org/x/net, which embeds a copy of the
+// Public Suffix List, implements this interface.
+type PublicSuffixList interface {
+	// The PublicSuffix method returns the public suffix of a domain name.
+	PublicSuffix(domain string) string
+}
+
+// The public suffix rules read from a file
+type publicSuffixRules struct {
+	rules      map[string]bool
+	wildcards  map[string]bool
+	exceptions map[string]bool
+}
+
+// The LoadPublicSuffixList function reads a PublicSuffixList from a file in
+// the format of the Public Suffix List (https://publicsuffix.org/list/), for
+// use in place of the embedded copy.
+func LoadPublicSuffixList(filename string) (PublicSuffixList, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	l := &publicSuffixRules{
+		rules:      make(map[string]bool),
+		wildcards:  make(map[string]bool),
+		exceptions: make(map[string]bool),
+	}
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "//") {
+			continue
+		}
+		rule := fields[0]
+		rules := l.rules
+		if strings.HasPrefix(rule, "!") {
+			rule, rules = rule[1:], l.exceptions
+		} else if strings.HasPrefix(rule, "*.") {
+			rule, rules = rule[2:], l.wildcards
+		}
+		rule, err = idna.Lookup.ToASCII(rule)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", filename, lineNumber, err)
+		}
+		rules[rule] = true
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// The PublicSuffix method returns the public suffix of a domain name using
+// the algorithm given at https://publicsuffix.org/list/. If no rule matches,
+// the last label is the public suffix.
+func (l *publicSuffixRules) PublicSuffix(domain string) string {
+	labels := strings.Split(domain, ".")
+	for i := range labels {
+		candidate := strings.Join(labels[i:], ".")
+		if l.exceptions[candidate] {
+			return strings.Join(labels[i+1:], ".")
+		}
+		if l.rules[candidate] {
+			return candidate
+		}
+		if i+1 < len(labels) && l.wildcards[strings.Join(labels[i+1:], ".")] {
+			return candidate
+		}
+	}
+	return labels[len(labels)-1]
+}
+
+// Returns the registrable domain (eTLD+1) and public suffix of a domain name.
+// The registrable domain is empty if the name is itself a public suffix.
+func registrableDomain(list PublicSuffixList, domain string) (string, string) {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	suffix := list.PublicSuffix(domain)
+	if len(domain) <= len(suffix) {
+		return "", suffix
+	}
+	rest := domain[:len(domain)-len(suffix)-1]
+	return rest[strings.LastIndex(rest, ".")+1:] + "." + suffix, suffix
+}
+
+// A PublicSuffixAnnotator wraps another TestList and adds the registrable
+// domain and public suffix of the domain of each job, in the
+// "hellfire_registrable_domain" and "hellfire_public_suffix" fields. The
+// embedded copy of the Public Suffix List is used unless another list is set.
+//
+// Jobs can also be deduplicated by registrable domain, so that only the first
+// job for each site is submitted. Jobs for IP addresses and for names that are
+// themselves public suffixes are never deduplicated.
+type PublicSuffixAnnotator struct {
+	TestList
+	list  PublicSuffixList
+	dedup bool
+}
+
+func NewPublicSuffixAnnotator(testList TestList) *PublicSuffixAnnotator {
+	a := new(PublicSuffixAnnotator)
+	a.TestList = testList
+	a.list = publicsuffix.List
+	return a
+}
+
+// The SetList method sets the PublicSuffixList to use in place of the
+// embedded copy of the Public Suffix List.
+func (a *PublicSuffixAnnotator) SetList(list PublicSuffixList) {
+	a.list = list
+}
+
+// The SetDedup method selects whether only the first job for each registrable
+// domain is submitted.
+func (a *PublicSuffixAnnotator) SetDedup(dedup bool) {
+	a.dedup = dedup
+}
+
+func (a *PublicSuffixAnnotator) FeedJobs(jobs chan map[string]interface{}) {
+	feedJobs(a, jobs)
+}
+
+func (a *PublicSuffixAnnotator) Feed(ctx context.Context, jobs chan map[string]interface{}) error {
+	seen := make(map[string]bool)
+	return feedThrough(ctx, a.TestList, func(job map[string]interface{}) error {
+		domain, ok := job["domain"].(string)
+		if !ok || domain == "" || net.ParseIP(domain) != nil {
+			return sendJob(ctx, jobs, job)
+		}
+		registrable, suffix := registrableDomain(a.list, domain)
+		job["hellfire_public_suffix"] = suffix
+		if registrable != "" {
+			job["hellfire_registrable_domain"] = registrable
+			if a.dedup {
+				if seen[registrable] {
+					return nil
+				}
+				seen[registrable] = true
+			}
+		}
+		return sendJob(ctx, jobs, job)
+	})
+}
@@ -0,0 +1,74 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testPublicSuffixList = `// A subset of the Public Suffix List
+com
+uk
+co.uk
+
+// Wildcard and exception rules
+ck
+*.ck
+!www.ck
+*.kawasaki.jp
+!city.kawasaki.jp
+
+// Unicode rules
+公司.cn
+`
+
+func TestPublicSuffixRules(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "public_suffix_list.dat")
+	err := os.WriteFile(filename, []byte(testPublicSuffixList), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := LoadPublicSuffixList(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		domain      string
+		suffix      string
+		registrable string
+	}{
+		{"example.com", "com", "example.com"},
+		{"www.example.com", "com", "example.com"},
+		{"com", "com", ""},
+		{"www.bbc.co.uk", "co.uk", "bbc.co.uk"},
+		{"co.uk", "co.uk", ""},
+		{"example.uk", "uk", "example.uk"},
+		// Wildcard rules
+		{"foo.ck", "foo.ck", ""},
+		{"a.foo.ck", "foo.ck", "a.foo.ck"},
+		{"b.a.foo.ck", "foo.ck", "a.foo.ck"},
+		{"ck", "ck", ""},
+		{"shop.kawasaki.jp", "shop.kawasaki.jp", ""},
+		// Exception rules
+		{"www.ck", "ck", "www.ck"},
+		{"a.www.ck", "ck", "www.ck"},
+		{"city.kawasaki.jp", "kawasaki.jp", "city.kawasaki.jp"},
+		{"a.city.kawasaki.jp", "kawasaki.jp", "city.kawasaki.jp"},
+		// Unicode rules are matched as A-labels
+		{"example.xn--55qx5d.cn", "xn--55qx5d.cn", "example.xn--55qx5d.cn"},
+		// Names matching no rule use the last label
+		{"example.test", "test", "example.test"},
+		{"localhost", "localhost", ""},
+	}
+	for _, test := range tests {
+		suffix := list.PublicSuffix(test.domain)
+		if suffix != test.suffix {
+			t.Errorf("PublicSuffix(%q): got %q, want %q", test.domain, suffix, test.suffix)
+		}
+		registrable, _ := registrableDomain(list, test.domain)
+		if registrable != test.registrable {
+			t.Errorf("registrableDomain(%q): got %q, want %q", test.domain, registrable, test.registrable)
+		}
+	}
+}
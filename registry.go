@@ -0,0 +1,198 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The name of the option that gives the file to read a list from, which is
+// accepted by every source.
+const FileOption string = "file"
+
+// A Source describes a type of TestList that can be selected by name. Sources
+// are registered with RegisterSource, which makes them available to
+// NewTestList and PrepareTestList, and so to the hellfire command.
+type Source struct {
+	// The name used to select the source, e.g. "cisco"
+	Name string
+	// The names of the options the source accepts, other than FileOption
+	Options []string
+	// The name of the option that is set by the variant of a specification,
+	// e.g. "country", or empty if the source has no variant. This must also
+	// be one of the Options.
+	Variant string
+	// The New function creates a TestList from the options given. Only
+	// options that have been set are present in the map.
+	New func(options map[string]string) (TestList, error)
+}
+
+// The Accepts method returns true if the source accepts an option, which is
+// either FileOption or one of its Options.
+func (s Source) Accepts(option string) bool {
+	if option == FileOption {
+		return true
+	}
+	for _, sourceOption := range s.Options {
+		if option == sourceOption {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	sourcesLock sync.RWMutex
+	sources     = make(map[string]Source)
+)
+
+// The RegisterSource function makes a source available by its name. It panics
+// if a source with the same name has already been registered.
+func RegisterSource(source Source) {
+	sourcesLock.Lock()
+	defer sourcesLock.Unlock()
+	if source.New == nil {
+		panic("RegisterSource: New is nil for source " + source.Name)
+	}
+	if _, dup := sources[source.Name]; dup {
+		panic("RegisterSource: source registered twice: " + source.Name)
+	}
+	sources[source.Name] = source
+}
+
+// The Sources function returns the names of the registered sources, sorted.
+func Sources() []string {
+	sourcesLock.RLock()
+	defer sourcesLock.RUnlock()
+	var names []string
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// The LookupSource function returns the registered source with a name.
+func LookupSource(name string) (Source, bool) {
+	sourcesLock.RLock()
+	defer sourcesLock.RUnlock()
+	source, ok := sources[name]
+	return source, ok
+}
+
+// The NewTestList function creates a TestList from the registered source with
+// a name. An error is returned if the source does not exist, does not accept
+// one of the options given, or if the source panics on an invalid option.
+func NewTestList(name string, options map[string]string) (testList TestList, err error) {
+	source, ok := LookupSource(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown source: %s", name)
+	}
+	for option := range options {
+		if !source.Accepts(option) {
+			return nil, fmt.Errorf("source %s does not accept the %s option", name, option)
+		}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			testList, err = nil, fmt.Errorf("source %s: %v", name, r)
+		}
+	}()
+	return source.New(options)
+}
+
+// The PrepareTestList function creates a TestList from an option string of
+// the form "name;variant;filename", where name selects the registered source,
+// variant is the value for the Variant option of the source (e.g. the country,
+// list name or list ID), and filename is the file to read the list from. The
+// variant and filename may be empty.
+func PrepareTestList(testListOptions string) TestList {
+	options := strings.Split(testListOptions, ";")
+
+	if len(options) < 3 {
+		return nil
+	}
+
+	testList, err := newTestListFromParts(options, nil)
+	if err != nil {
+		panic(err)
+	}
+	return testList
+}
+
+// The NewTestListFromSpec function creates a TestList from a specification of
+// the form "name[:variant[:filename]]", with the same meaning as the option
+// string for PrepareTestList. The variant may be left empty to give only a
+// filename, as in "citizenlab::list.csv". For sources that have no variant,
+// everything after the name is the filename, so that "txt:list.txt" and
+// "txt::list.txt" are the same.
+func NewTestListFromSpec(spec string) (TestList, error) {
+	return NewTestListFromSpecWithOptions(spec, nil)
+}
+
+// The NewTestListFromSpecWithOptions function creates a TestList from a
+// specification as for NewTestListFromSpec, also applying those of the options
+// given that the source accepts. This allows options to be shared between
+// several specifications, with the variant and filename in each specification
+// taking precedence.
+func NewTestListFromSpecWithOptions(spec string, options map[string]string) (TestList, error) {
+	name, rest, _ := strings.Cut(spec, ":")
+	parts := []string{name, "", ""}
+	if source, ok := LookupSource(name); ok && source.Variant == "" {
+		parts[2] = strings.TrimPrefix(rest, ":")
+	} else {
+		parts[1], parts[2], _ = strings.Cut(rest, ":")
+	}
+	return newTestListFromParts(parts, options)
+}
+
+func newTestListFromParts(parts []string, sharedOptions map[string]string) (TestList, error) {
+	source, ok := LookupSource(parts[0])
+	if !ok {
+		return nil, fmt.Errorf("unknown source: %s", parts[0])
+	}
+
+	options := make(map[string]string)
+	for option, value := range sharedOptions {
+		if source.Accepts(option) {
+			options[option] = value
+		}
+	}
+	if parts[1] != "" {
+		if source.Variant == "" {
+			return nil, fmt.Errorf("source %s does not accept a variant", parts[0])
+		}
+		options[source.Variant] = parts[1]
+	}
+	if parts[2] != "" {
+		options[FileOption] = parts[2]
+	}
+
+	return NewTestList(parts[0], options)
+}
+
+// Returns an error if the FileOption has not been set, for sources that can
+// only be read from a file.
+func requireFile(name string, options map[string]string) error {
+	if options[FileOption] == "" {
+		return fmt.Errorf("source %s requires a file", name)
+	}
+	return nil
+}
+
+// Applies the revision options accepted by sources held in git repositories.
+func setRevisionOptions(l RevisionedList, options map[string]string) {
+	if options["revision"] != "" {
+		l.SetRevision(options["revision"])
+	}
+	if options["date"] != "" {
+		l.SetDate(options["date"])
+	}
+	if options["checkout"] != "" {
+		l.SetCheckout(options["checkout"])
+	}
+}
+
+// The names of the options accepted by sources held in git repositories
+var revisionOptions = []string{"revision", "date", "checkout"}
@@ -0,0 +1,70 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewTestListFromSpec(t *testing.T) {
+	dir := t.TempDir()
+	csvFile := filepath.Join(dir, "list.csv")
+	os.WriteFile(csvFile, []byte("domain\nexample.com\n"), 0644)
+	txtFile := filepath.Join(dir, "list:1.txt")
+	os.WriteFile(txtFile, []byte("example.net\n"), 0644)
+	citizenLabFile := filepath.Join(dir, "ir.csv")
+	os.WriteFile(citizenLabFile, []byte("url,category_code\nhttp://example.org/,NEWS\nhttp://example.info/,HUMR\n"), 0644)
+
+	tests := []struct {
+		spec    string
+		options map[string]string
+		want    []string
+	}{
+		{"csv:" + csvFile, nil, []string{"example.com"}},
+		{"csv::" + csvFile, nil, []string{"example.com"}},
+		{"txt:" + txtFile, nil, []string{"example.net"}},
+		{"txt::" + txtFile, nil, []string{"example.net"}},
+		{"csv:" + csvFile, map[string]string{"domain-column": "1", "category": "NEWS"}, []string{"example.com"}},
+		{"citizenlab::" + citizenLabFile, nil, []string{"example.org", "example.info"}},
+		{"citizenlab::" + citizenLabFile, map[string]string{"category": "NEWS", "delimiter": ","}, []string{"example.org"}},
+	}
+	for _, test := range tests {
+		testList, err := NewTestListFromSpecWithOptions(test.spec, test.options)
+		if err != nil {
+			t.Errorf("%s: %s", test.spec, err)
+			continue
+		}
+		jobs, err := collectJobs(testList.(Feeder))
+		if err != nil {
+			t.Errorf("%s: %s", test.spec, err)
+			continue
+		}
+		var domains []string
+		for _, job := range jobs {
+			domains = append(domains, job["domain"].(string))
+		}
+		if !reflect.DeepEqual(domains, test.want) {
+			t.Errorf("%s: got %v, want %v", test.spec, domains, test.want)
+		}
+	}
+}
+
+func TestNewTestListFromSpecErrors(t *testing.T) {
+	tests := []struct {
+		spec  string
+		error string
+	}{
+		{"nonexistent", "unknown source: nonexistent"},
+		{"csv", "source csv requires a file"},
+		{"csv::", "source csv requires a file"},
+		{"txt:/nonexistent/list.txt", "no such file"},
+	}
+	for _, test := range tests {
+		_, err := NewTestListFromSpec(test.spec)
+		if err == nil || !strings.Contains(err.Error(), test.error) {
+			t.Errorf("%s: got error %v, want one containing %q", test.spec, err, test.error)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// URL format string to find the latest commit to a GitHub repository before a
+// date. The %s will be replaced with the repository, the branch and the date.
+const GitHubCommitsURL string = "https://api.github.com/repos/%s/commits?sha=%s&until=%sT23:59:59Z&per_page=1"
+
+// The RevisionedList interface is implemented by lists that are held in a git
+// repository and can be pinned to a revision of that repository, allowing
+// historical measurements to be regenerated with the exact list used.
+type RevisionedList interface {
+	TestList
+	SetRevision(string)
+	SetDate(string)
+	SetCheckout(string)
+}
+
+// A gitSource selects the revision of a list that is held in a git
+// repository. Lists embedding a gitSource can be pinned to a revision or to
+// the state of the repository at the end of a date, and can be read from a
+// local clone of the repository rather than downloaded.
+type gitSource struct {
+	revision string
+	date     string
+	checkout string
+	resolved string
+}
+
+// The SetRevision method pins the list to a revision of the repository, which
+// may be a commit hash, tag or branch name.
+func (s *gitSource) SetRevision(revision string) {
+	s.revision = revision
+}
+
+// The SetDate method pins the list to the last revision of the repository on
+// or before a date in UTC, given in the form YYYY-MM-DD. This is used only
+// when no revision has been set.
+func (s *gitSource) SetDate(date string) {
+	_, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		panic("Date must be given in the form YYYY-MM-DD.")
+	}
+	s.date = date
+}
+
+// The SetCheckout method selects a local clone of the repository to read the
+// list from instead of downloading it. If a revision or date is set, the list
+// is read from that revision using git; otherwise the file in the working
+// tree is read.
+func (s *gitSource) SetCheckout(checkout string) {
+	s.checkout = checkout
+}
+
+// Returns the revision of the repository to use, resolving a date to the last
+// commit on or before that date. Dates are taken to be in UTC. When reading
+// from a local clone, the revision is resolved to a commit hash. The revision
+// is only resolved once, so that every file is read from the same revision.
+func (s *gitSource) resolveRevision(repository string, branch string) (string, error) {
+	if s.resolved != "" {
+		return s.resolved, nil
+	}
+	revision, err := s.findRevision(repository, branch)
+	if err != nil {
+		return "", err
+	}
+	s.resolved = revision
+	return revision, nil
+}
+
+func (s *gitSource) findRevision(repository string, branch string) (string, error) {
+	if s.checkout != "" {
+		var args []string
+		if s.revision != "" {
+			args = []string{"rev-parse", "--verify", s.revision + "^{commit}"}
+		} else if s.date != "" {
+			args = []string{"rev-list", "-1", "--before=" + s.date + " 23:59:59 +0000", branch}
+		} else {
+			// The working tree is read, so the revision is the commit
+			// that is checked out
+			args = []string{"rev-parse", "--verify", "HEAD^{commit}"}
+		}
+		out, err := exec.Command("git", append([]string{"-C", s.checkout}, args...)...).Output()
+		if err != nil {
+			return "", fmt.Errorf("error finding the revision of %s: %s", s.checkout, err)
+		}
+		revision := strings.TrimSpace(string(out))
+		if revision == "" {
+			return "", fmt.Errorf("no revision of %s on or before %s", repository, s.date)
+		}
+		return revision, nil
+	}
+	if s.revision != "" {
+		return s.revision, nil
+	}
+	if s.date == "" {
+		return branch, nil
+	}
+
+	urlReader, _, err := getReaderFromSource("github-commits", repository, branch, s.date)
+	if err != nil {
+		return "", err
+	}
+	var commits []struct {
+		SHA string `json:"sha"`
+	}
+	err = json.NewDecoder(urlReader).Decode(&commits)
+	if err != nil {
+		return "", err
+	}
+	if len(commits) == 0 {
+		return "", fmt.Errorf("no revision of %s on or before %s", repository, s.date)
+	}
+	return commits[0].SHA, nil
+}
+
+// Returns a reader for a file in the repository at the selected revision,
+// along with a description of where it was read from and the revision read.
+// When the file is read from the working tree of a local clone, the revision
+// is the commit checked out, with "-dirty" appended if the file differs from
+// that commit. The path is the path of the file within the repository, used
+// when reading from a local clone, and download is used to download the file
+// at a given revision otherwise.
+func (s *gitSource) getReader(repository string, branch string, path string,
+	download func(revision string) (*bytes.Reader, string, error)) (*bytes.Reader, string, string, error) {
+	revision, err := s.resolveRevision(repository, branch)
+	if err != nil {
+		return nil, repository, "", err
+	}
+
+	if s.checkout != "" && s.revision == "" && s.date == "" {
+		filename := filepath.Join(s.checkout, filepath.FromSlash(path))
+		body, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, filename, "", err
+		}
+		status, err := exec.Command("git", "-C", s.checkout, "status", "--porcelain", "--", path).Output()
+		if err != nil {
+			return nil, filename, "", fmt.Errorf("error finding the status of %s: %s", filename, err)
+		}
+		if len(bytes.TrimSpace(status)) > 0 {
+			revision += "-dirty"
+		}
+		return bytes.NewReader(body), filename, revision, nil
+	}
+
+	if s.checkout != "" {
+		source := revision + ":" + path
+		body, err := exec.Command("git", "-C", s.checkout, "show", source).Output()
+		return bytes.NewReader(body), source, revision, err
+	}
+
+	reader, source, err := download(revision)
+	return reader, source, revision, err
+}
@@ -0,0 +1,80 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Runs git in a repository, with fixed identities and the given commit date.
+func runGit(t *testing.T, dir string, date string, args ...string) string {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+		"GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %s: %s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestGitSourceCheckout(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "list.txt")
+	runGit(t, dir, "", "init", "-q")
+	os.WriteFile(filename, []byte("first\n"), 0644)
+	runGit(t, dir, "", "add", "list.txt")
+	runGit(t, dir, "2020-01-01T23:00:00+0000", "commit", "-q", "-m", "first")
+	first := runGit(t, dir, "", "rev-parse", "HEAD")
+	os.WriteFile(filename, []byte("second\n"), 0644)
+	// Committed on 2020-01-02 in UTC, although on 2020-01-01 in UTC-10
+	runGit(t, dir, "2020-01-01T15:00:00-1000", "commit", "-q", "-a", "-m", "second")
+	second := runGit(t, dir, "", "rev-parse", "HEAD")
+
+	download := func(revision string) (*bytes.Reader, string, error) {
+		t.Fatalf("downloaded %s instead of reading the checkout", revision)
+		return nil, "", nil
+	}
+	tests := []struct {
+		name     string
+		setup    func(s *gitSource)
+		dirty    bool
+		body     string
+		revision string
+	}{
+		{"working tree", func(s *gitSource) {}, false, "second\n", second},
+		{"modified working tree", func(s *gitSource) {}, true, "modified\n", second + "-dirty"},
+		{"revision", func(s *gitSource) { s.SetRevision(first[:10]) }, false, "first\n", first},
+		{"date", func(s *gitSource) { s.SetDate("2020-01-01") }, false, "first\n", first},
+		{"later date", func(s *gitSource) { s.SetDate("2020-01-02") }, false, "second\n", second},
+	}
+	for _, test := range tests {
+		content := "second\n"
+		if test.dirty {
+			content = "modified\n"
+		}
+		os.WriteFile(filename, []byte(content), 0644)
+
+		s := new(gitSource)
+		s.SetCheckout(dir)
+		test.setup(s)
+		reader, _, revision, err := s.getReader("example/list", "master", "list.txt", download)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		body, _ := io.ReadAll(reader)
+		if string(body) != test.body || revision != test.revision {
+			t.Errorf("%s: got %q at %s, want %q at %s", test.name, body, revision, test.body, test.revision)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+)
+
+// A ShapedList wraps another TestList to select only part of its jobs. Jobs
+// can be selected by their rank, sampled at random and limited in number.
+// These are applied in that order, so that for example a random sample of
+// 5000 jobs can be taken from those ranked between 100000 and 1000000.
+type ShapedList struct {
+	TestList
+	limit          int
+	rankMin        int
+	rankMax        int
+	sampleSize     int
+	sampleFraction float64
+	seed           int64
+}
+
+type sampledJob struct {
+	index int
+	job   map[string]interface{}
+}
+
+func NewShapedList(testList TestList) *ShapedList {
+	l := new(ShapedList)
+	l.TestList = testList
+	return l
+}
+
+// The SetLimit method limits the number of jobs submitted to at most limit.
+// A limit of zero means no limit.
+func (l *ShapedList) SetLimit(limit int) {
+	l.limit = limit
+}
+
+// The SetRankRange method selects only jobs with a "rank" field between min
+// and max inclusive. Jobs without a numeric rank are dropped. A max of zero
+// means no upper bound.
+func (l *ShapedList) SetRankRange(min int, max int) {
+	l.rankMin = min
+	l.rankMax = max
+}
+
+// The SetSample method selects a uniform random sample of size jobs. The jobs
+// in the sample are submitted in the order they appear in the list.
+func (l *ShapedList) SetSample(size int) {
+	l.sampleSize = size
+}
+
+// The SetSampleFraction method selects each job at random with probability
+// fraction.
+func (l *ShapedList) SetSampleFraction(fraction float64) {
+	l.sampleFraction = fraction
+}
+
+// The SetSeed method sets the seed for random sampling, so that the same
+// sample can be selected again.
+func (l *ShapedList) SetSeed(seed int64) {
+	l.seed = seed
+}
+
+// Returns the rank of a job, which may be held as a string, a number or a
+// JSON number.
+func jobRank(job map[string]interface{}) (int, bool) {
+	if job["rank"] == nil {
+		return 0, false
+	}
+	rank, err := strconv.Atoi(fmt.Sprint(job["rank"]))
+	if err != nil {
+		return 0, false
+	}
+	return rank, true
+}
+
+func (l *ShapedList) inRankRange(job map[string]interface{}) bool {
+	if l.rankMin == 0 && l.rankMax == 0 {
+		return true
+	}
+	rank, ok := jobRank(job)
+	if !ok {
+		return false
+	}
+	return rank >= l.rankMin && (l.rankMax == 0 || rank <= l.rankMax)
+}
+
+func (l *ShapedList) FeedJobs(jobs chan map[string]interface{}) {
+	feedJobs(l, jobs)
+}
+
+func (l *ShapedList) Feed(ctx context.Context, jobs chan map[string]interface{}) error {
+	random := rand.New(rand.NewSource(l.seed))
+	submitted := 0
+	index := 0
+	var reservoir []sampledJob
+
+	err := feedThrough(ctx, l.TestList, func(job map[string]interface{}) error {
+		if !l.inRankRange(job) {
+			return nil
+		}
+		if l.sampleFraction > 0 && random.Float64() >= l.sampleFraction {
+			return nil
+		}
+		if l.sampleSize > 0 {
+			// Reservoir sampling, as the length of the list is
+			// not known in advance
+			if index < l.sampleSize {
+				reservoir = append(reservoir, sampledJob{index, job})
+			} else if r := random.Intn(index + 1); r < l.sampleSize {
+				reservoir[r] = sampledJob{index, job}
+			}
+			index++
+			return nil
+		}
+		err := sendJob(ctx, jobs, job)
+		if err != nil {
+			return err
+		}
+		submitted++
+		if l.limit > 0 && submitted >= l.limit {
+			return errStopFeeding
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(reservoir, func(i, j int) bool {
+		return reservoir[i].index < reservoir[j].index
+	})
+	for _, sampled := range reservoir {
+		if l.limit > 0 && submitted >= l.limit {
+			break
+		}
+		err = sendJob(ctx, jobs, sampled.job)
+		if err != nil {
+			return err
+		}
+		submitted++
+	}
+	return nil
+}
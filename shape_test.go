@@ -0,0 +1,162 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// A TestList of numbered jobs that never ends, to check that feeding stops.
+type endlessList struct {
+	TestList
+	fed int
+}
+
+func (l *endlessList) Feed(ctx context.Context, jobs chan map[string]interface{}) error {
+	for {
+		l.fed++
+		job := map[string]interface{}{"domain": fmt.Sprintf("%d.example", l.fed), "rank": l.fed}
+		if err := sendJob(ctx, jobs, job); err != nil {
+			return err
+		}
+	}
+}
+
+// Returns a list of n jobs ranked from 1 to n, with every tenth job unranked.
+func rankedList(n int) TestList {
+	var b strings.Builder
+	b.WriteString("rank,domain\n")
+	for rank := 1; rank <= n; rank++ {
+		if rank%10 == 0 {
+			fmt.Fprintf(&b, ",%d.example\n", rank)
+		} else {
+			fmt.Fprintf(&b, "%d,%d.example\n", rank, rank)
+		}
+	}
+	return CSVListFromReader(strings.NewReader(b.String()))
+}
+
+// Feeds a ShapedList and returns the domains of the jobs submitted.
+func shapedDomains(t *testing.T, l *ShapedList) []string {
+	jobs, err := collectJobs(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var domains []string
+	for _, job := range jobs {
+		domains = append(domains, job["domain"].(string))
+	}
+	return domains
+}
+
+// Returns the names n.example for each n given.
+func exampleNames(numbers ...int) []string {
+	var names []string
+	for _, n := range numbers {
+		names = append(names, fmt.Sprintf("%d.example", n))
+	}
+	return names
+}
+
+func TestShapedListRankRangeAndLimit(t *testing.T) {
+	tests := []struct {
+		min, max, limit int
+		want            []string
+	}{
+		{0, 0, 3, exampleNames(1, 2, 3)},
+		{5, 12, 0, exampleNames(5, 6, 7, 8, 9, 11, 12)},
+		{5, 12, 3, exampleNames(5, 6, 7)},
+		{95, 0, 0, exampleNames(95, 96, 97, 98, 99)},
+		{8, 11, 10, exampleNames(8, 9, 11)},
+	}
+	for _, test := range tests {
+		l := NewShapedList(rankedList(100))
+		l.SetRankRange(test.min, test.max)
+		l.SetLimit(test.limit)
+		got := shapedDomains(t, l)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ranks %d-%d, limit %d: got %v, want %v", test.min, test.max, test.limit, got, test.want)
+		}
+	}
+}
+
+func TestShapedListSample(t *testing.T) {
+	sample := func(seed int64, size int, limit int) []string {
+		l := NewShapedList(rankedList(1000))
+		l.SetRankRange(100, 500)
+		l.SetSample(size)
+		l.SetLimit(limit)
+		l.SetSeed(seed)
+		return shapedDomains(t, l)
+	}
+
+	first := sample(1, 20, 0)
+	if len(first) != 20 {
+		t.Fatalf("got a sample of %d, want 20", len(first))
+	}
+	if again := sample(1, 20, 0); !reflect.DeepEqual(again, first) {
+		t.Errorf("same seed gave a different sample: %v and %v", first, again)
+	}
+	if other := sample(2, 20, 0); reflect.DeepEqual(other, first) {
+		t.Errorf("different seeds gave the same sample: %v", first)
+	}
+
+	// The sample is in list order and within the rank range
+	previous := 0
+	for _, domain := range first {
+		var rank int
+		fmt.Sscanf(domain, "%d.example", &rank)
+		if rank <= previous || rank < 100 || rank > 500 || rank%10 == 0 {
+			t.Errorf("sample not in list order within the rank range: %v", first)
+			break
+		}
+		previous = rank
+	}
+
+	// The limit applies after sampling, taking the start of the sample
+	if limited := sample(1, 20, 5); !reflect.DeepEqual(limited, first[:5]) {
+		t.Errorf("limit after sampling: got %v, want %v", limited, first[:5])
+	}
+
+	// A sample larger than the list is the whole list
+	l := NewShapedList(rankedList(5))
+	l.SetSample(10)
+	if got := shapedDomains(t, l); !reflect.DeepEqual(got, exampleNames(1, 2, 3, 4, 5)) {
+		t.Errorf("large sample: got %v", got)
+	}
+}
+
+func TestShapedListSampleFraction(t *testing.T) {
+	sample := func(seed int64, fraction float64) []string {
+		l := NewShapedList(rankedList(1000))
+		l.SetSampleFraction(fraction)
+		l.SetSeed(seed)
+		return shapedDomains(t, l)
+	}
+	first := sample(1, 0.1)
+	if len(first) < 50 || len(first) > 150 {
+		t.Errorf("got %d of 1000 jobs for a fraction of 0.1", len(first))
+	}
+	if again := sample(1, 0.1); !reflect.DeepEqual(again, first) {
+		t.Errorf("same seed gave a different sample")
+	}
+	if all := sample(1, 1); len(all) != 1000 {
+		t.Errorf("got %d of 1000 jobs for a fraction of 1", len(all))
+	}
+}
+
+func TestShapedListStopsAtLimit(t *testing.T) {
+	endless := new(endlessList)
+	l := NewShapedList(endless)
+	l.SetLimit(5)
+	got := shapedDomains(t, l)
+	if !reflect.DeepEqual(got, exampleNames(1, 2, 3, 4, 5)) {
+		t.Errorf("got %v", got)
+	}
+	// One further job may be fed before the cancellation is noticed
+	if endless.fed > 7 {
+		t.Errorf("fed %d jobs for a limit of 5", endless.fed)
+	}
+}
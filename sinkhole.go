@@ -0,0 +1,87 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"net"
+)
+
+// Known sinkhole and blockpage addresses. These are returned in place of the
+// genuine answer by DNS-based censorship and filtering systems. Entries marked
+// as blockpages are censorship answers that are reported even when they fall
+// in a special-purpose range; the null-route answers are not, so that they
+// are still dropped by an AddressFilter.
+var knownSinkholes = []struct {
+	cidr      string
+	label     string
+	blockpage bool
+}{
+	// Iran: addresses of the national blockpage (peyvandha.ir)
+	{"10.10.34.34", "ir-blockpage", true},
+	{"10.10.34.35", "ir-blockpage", true},
+	{"10.10.34.36", "ir-blockpage", true},
+	// Turkey: blockpage of the Telecommunications Communication Presidency
+	{"195.175.254.2", "tr-blockpage", true},
+	// China: addresses injected by the Great Firewall
+	{"8.7.198.45", "cn-injected", true},
+	{"37.61.54.158", "cn-injected", true},
+	{"46.82.174.68", "cn-injected", true},
+	{"59.24.3.173", "cn-injected", true},
+	{"78.16.49.15", "cn-injected", true},
+	{"93.46.8.89", "cn-injected", true},
+	{"159.106.121.75", "cn-injected", true},
+	{"203.98.7.65", "cn-injected", true},
+	{"243.185.187.39", "cn-injected", true},
+	// Unroutable answers commonly used to null-route names
+	{"0.0.0.0", "null", false},
+	{"127.0.0.1", "null", false},
+	{"::", "null", false},
+	{"::1", "null", false},
+}
+
+// A SinkholeList annotates results whose addresses are known sinkhole or
+// blockpage addresses. This separates names that resolve to a censorship
+// blockpage from genuine targets. Matching results are not dropped but are
+// output with the label of the matching entry in the "hellfire_sinkhole"
+// field. Results matching a known blockpage are also given a
+// "hellfire_blockpage" field, which exempts them from being dropped by an
+// AddressFilter later in the filters.
+type SinkholeList struct {
+	ResultFilter
+	entries []filterEntry
+}
+
+// The AddKnownSinkholes method adds the list of known sinkhole and blockpage
+// addresses that is shipped with hellfire.
+func (l *SinkholeList) AddKnownSinkholes() {
+	for _, s := range knownSinkholes {
+		network, err := parseCIDROrIP(s.cidr)
+		if err != nil {
+			panic(err)
+		}
+		l.entries = append(l.entries, filterEntry{network, s.label, s.blockpage})
+	}
+}
+
+// The LoadFile method adds the sinkhole addresses listed in a file. The file
+// contains one address or range in CIDR notation per line, optionally
+// followed by a label. Blank lines and lines starting with "#" are ignored.
+// Entries listed without a label are given the label "sinkhole". Entries from
+// a file are never treated as blockpages.
+func (l *SinkholeList) LoadFile(filename string) error {
+	entries, err := loadCIDRList(filename, "sinkhole")
+	if err != nil {
+		return err
+	}
+	l.entries = append(l.entries, entries...)
+	return nil
+}
+
+func (l *SinkholeList) FilterResult(result map[string]interface{}, ip net.IP) bool {
+	entry := matchEntry(l.entries, ip)
+	if entry != nil {
+		result["hellfire_sinkhole"] = entry.reason
+		if entry.blockpage {
+			result["hellfire_blockpage"] = true
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestSinkholeAddressFilter(t *testing.T) {
+	sinkholes := new(SinkholeList)
+	sinkholes.AddKnownSinkholes()
+	bogons := new(AddressFilter)
+	bogons.AddSpecialPurpose()
+	filters := []ResultFilter{sinkholes, bogons}
+
+	tests := []struct {
+		address string
+		want    map[string]interface{}
+	}{
+		{"93.184.216.34", map[string]interface{}{}},
+		{"10.10.34.35", map[string]interface{}{"hellfire_sinkhole": "ir-blockpage", "hellfire_blockpage": true, "hellfire_filtered": "private"}},
+		{"243.185.187.39", map[string]interface{}{"hellfire_sinkhole": "cn-injected", "hellfire_blockpage": true, "hellfire_filtered": "reserved"}},
+		{"159.106.121.75", map[string]interface{}{"hellfire_sinkhole": "cn-injected", "hellfire_blockpage": true}},
+		{"127.0.0.1", nil},
+		{"0.0.0.0", nil},
+		{"::1", nil},
+		{"10.0.0.1", nil},
+	}
+	for _, test := range tests {
+		result := make(map[string]interface{})
+		kept := true
+		for _, filter := range filters {
+			if !filter.FilterResult(result, net.ParseIP(test.address)) {
+				kept = false
+				break
+			}
+		}
+		if test.want == nil {
+			if kept {
+				t.Errorf("%s: kept as %v, want dropped", test.address, result)
+			}
+		} else if !kept {
+			t.Errorf("%s: dropped, want %v", test.address, test.want)
+		} else if !reflect.DeepEqual(result, test.want) {
+			t.Errorf("%s: got %v, want %v", test.address, result, test.want)
+		}
+	}
+
+	// Null-route answers are still flagged as sinkholes when not dropped
+	bogons.SetFlag(true)
+	result := make(map[string]interface{})
+	for _, filter := range filters {
+		filter.FilterResult(result, net.ParseIP("127.0.0.1"))
+	}
+	want := map[string]interface{}{"hellfire_sinkhole": "null", "hellfire_filtered": "loopback"}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("127.0.0.1 flagged: got %v, want %v", result, want)
+	}
+}
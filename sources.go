@@ -0,0 +1,114 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// The names of the sources whose URLs can be overridden, and the default URL
+// for each. Where the default URL is a format string, any URL given in its
+// place must take the same arguments.
+var SourceURLs = map[string]string{
+	"topsites":       AlexaTopsitesURL,
+	"cisco":          CiscoUmbrellaURL,
+	"tranco":         TrancoListURL,
+	"tranco-id":      TrancoLatestIDURL,
+	"majestic":       MajesticMillionURL,
+	"crux":           CrUXTopOriginsURL,
+	"citizenlab":     CitizenLabCountryListURL,
+	"opendns":        OpenDNSListURL,
+	"github-commits": GitHubCommitsURL,
+}
+
+// The URLs set in place of the defaults, in the order they are tried
+var sourceMirrors = make(map[string][]string)
+
+// The SetSourceURLs function overrides the URL used to download a source with
+// an ordered list of mirrors. Each mirror is tried in turn until a download
+// succeeds. The name must be one of the keys of SourceURLs.
+func SetSourceURLs(name string, urls []string) error {
+	if _, ok := SourceURLs[name]; !ok {
+		return fmt.Errorf("unknown source: %s", name)
+	}
+	sourceMirrors[name] = urls
+	return nil
+}
+
+// The LoadSourceURLsFromEnv function overrides source URLs from environment
+// variables of the form HELLFIRE_<NAME>_URL, where the name is upper case
+// with "-" replaced by "_" (e.g. HELLFIRE_GITHUB_COMMITS_URL). The value is a
+// whitespace separated list of mirrors.
+func LoadSourceURLsFromEnv() {
+	for name := range SourceURLs {
+		variable := "HELLFIRE_" + strings.ToUpper(strings.Replace(name, "-", "_", -1)) + "_URL"
+		if value := os.Getenv(variable); value != "" {
+			sourceMirrors[name] = strings.Fields(value)
+		}
+	}
+}
+
+// The LoadSourceURLsFile function overrides source URLs from a configuration
+// file. Each line holds the name of a source followed by a whitespace
+// separated list of mirrors. Blank lines and lines starting with "#" are
+// ignored.
+func LoadSourceURLsFile(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return fmt.Errorf("%s:%d: no URLs given for %s", filename, lineNumber, fields[0])
+		}
+		err = SetSourceURLs(fields[0], fields[1:])
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s", filename, lineNumber, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// Downloads a source, trying each of its mirrors in turn, or the default URL
+// if no mirrors have been set. Any arguments are used to fill in the URL
+// format string. The URL that the source was downloaded from is returned, or
+// if every URL failed, a description of the URLs tried.
+func getReaderFromSource(name string, args ...interface{}) (*bytes.Reader, string, error) {
+	urls, ok := sourceMirrors[name]
+	if !ok {
+		urls = []string{SourceURLs[name]}
+	}
+
+	var tried []string
+	var errs []string
+	var err error
+	for _, urlFormat := range urls {
+		url := urlFormat
+		if len(args) > 0 {
+			url = fmt.Sprintf(urlFormat, args...)
+		}
+		var reader *bytes.Reader
+		reader, err = getReaderFromUrl(url)
+		if err == nil {
+			return reader, url, nil
+		}
+		tried = append(tried, url)
+		errs = append(errs, fmt.Sprintf("<%s>: %s", url, err))
+	}
+	if len(tried) > 1 {
+		err = fmt.Errorf("all mirrors failed: %s", strings.Join(errs, "; "))
+	}
+	return nil, strings.Join(tried, ", "), err
+}
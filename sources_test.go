@@ -0,0 +1,173 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Clears the source URL overrides and the cache settings, restoring them when
+// the test ends.
+func resetSources(t *testing.T) {
+	savedMirrors, savedCacheDir, savedOffline := sourceMirrors, cacheDir, offline
+	sourceMirrors = make(map[string][]string)
+	cacheDir, offline = "", false
+	t.Cleanup(func() {
+		sourceMirrors, cacheDir, offline = savedMirrors, savedCacheDir, savedOffline
+	})
+}
+
+// A stand-in server that records the paths requested, fails requests for
+// paths starting with "/fail", and otherwise returns the path as the body.
+type standInServer struct {
+	*httptest.Server
+	lock      sync.Mutex
+	requested []string
+}
+
+func newStandInServer(t *testing.T) *standInServer {
+	s := new(standInServer)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.lock.Lock()
+		s.requested = append(s.requested, r.URL.Path)
+		s.lock.Unlock()
+		if strings.HasPrefix(r.URL.Path, "/fail") {
+			http.Error(w, "failed", http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, r.URL.Path)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestSourceMirrorFallback(t *testing.T) {
+	resetSources(t)
+	s := newStandInServer(t)
+
+	SetSourceURLs("cisco", []string{s.URL + "/fail1", s.URL + "/fail2", s.URL + "/good", s.URL + "/unused"})
+	reader, source, err := getReaderFromSource("cisco")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(reader)
+	if string(body) != "/good" || source != s.URL+"/good" {
+		t.Errorf("got %q from %s, want \"/good\" from %s/good", body, source, s.URL)
+	}
+	want := []string{"/fail1", "/fail2", "/good"}
+	if strings.Join(s.requested, " ") != strings.Join(want, " ") {
+		t.Errorf("requested %v, want %v", s.requested, want)
+	}
+}
+
+func TestSourceMirrorsFailed(t *testing.T) {
+	resetSources(t)
+	s := newStandInServer(t)
+
+	SetSourceURLs("cisco", []string{s.URL + "/fail1", s.URL + "/fail2"})
+	_, source, err := getReaderFromSource("cisco")
+	if err == nil {
+		t.Fatal("got no error when all mirrors failed")
+	}
+	if source != s.URL+"/fail1, "+s.URL+"/fail2" {
+		t.Errorf("got source %q, want both mirrors", source)
+	}
+	for _, want := range []string{"all mirrors failed", "<" + s.URL + "/fail1>: unexpected status: 500", "<" + s.URL + "/fail2>: unexpected status: 500"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("got error %q, want one containing %q", err, want)
+		}
+	}
+
+	// A single URL gives its own error
+	SetSourceURLs("cisco", []string{s.URL + "/fail3"})
+	_, source, err = getReaderFromSource("cisco")
+	if err == nil || strings.Contains(err.Error(), "all mirrors failed") || source != s.URL+"/fail3" {
+		t.Errorf("got %q with error %v for a single URL", source, err)
+	}
+}
+
+func TestSourceMirrorFormat(t *testing.T) {
+	resetSources(t)
+	s := newStandInServer(t)
+
+	SetSourceURLs("citizenlab", []string{s.URL + "/fail/%s/%s.csv", s.URL + "/lists/%s/%s.csv"})
+	reader, _, err := getReaderFromSource("citizenlab", "abc123", "ir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(reader)
+	if string(body) != "/lists/abc123/ir.csv" {
+		t.Errorf("got %q, want \"/lists/abc123/ir.csv\"", body)
+	}
+}
+
+func TestSourceURLPrecedence(t *testing.T) {
+	resetSources(t)
+	s := newStandInServer(t)
+
+	// The hellfire command loads the environment, then the file, then the
+	// --mirrors option, with each replacing the mirrors set before
+	t.Setenv("HELLFIRE_CISCO_URL", s.URL+"/env/cisco")
+	t.Setenv("HELLFIRE_MAJESTIC_URL", s.URL+"/env/majestic")
+	t.Setenv("HELLFIRE_CRUX_URL", s.URL+"/fail "+s.URL+"/env/crux")
+	t.Setenv("HELLFIRE_GITHUB_COMMITS_URL", s.URL+"/env/%s/%s/%s")
+	filename := filepath.Join(t.TempDir(), "mirrors")
+	os.WriteFile(filename, []byte("# Mirrors\n\ncisco "+s.URL+"/file/cisco\nmajestic "+s.URL+"/file/majestic\n"), 0644)
+
+	LoadSourceURLsFromEnv()
+	if err := LoadSourceURLsFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetSourceURLs("cisco", []string{s.URL + "/flag/cisco"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []interface{}
+		want string
+	}{
+		{"cisco", nil, "/flag/cisco"},
+		{"majestic", nil, "/file/majestic"},
+		{"crux", nil, "/env/crux"},
+		{"github-commits", []interface{}{"a", "b", "c"}, "/env/a/b/c"},
+	}
+	for _, test := range tests {
+		reader, _, err := getReaderFromSource(test.name, test.args...)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		body, _ := io.ReadAll(reader)
+		if string(body) != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, body, test.want)
+		}
+	}
+	if _, ok := sourceMirrors["tranco"]; ok {
+		t.Errorf("tranco: got mirrors %v, want the default URL", sourceMirrors["tranco"])
+	}
+}
+
+func TestLoadSourceURLsFileErrors(t *testing.T) {
+	resetSources(t)
+	tests := []struct {
+		content string
+		error   string
+	}{
+		{"cisco http://example.com/\nnonexistent http://example.com/\n", ":2: unknown source: nonexistent"},
+		{"# comment\ncisco\n", ":2: no URLs given for cisco"},
+	}
+	for _, test := range tests {
+		filename := filepath.Join(t.TempDir(), "mirrors")
+		os.WriteFile(filename, []byte(test.content), 0644)
+		err := LoadSourceURLsFile(filename)
+		if err == nil || !strings.Contains(err.Error(), test.error) {
+			t.Errorf("got error %v, want one containing %q", err, test.error)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type TrancoList struct {
+	TestList
+	listID   string
+	filename string
+}
+
+// URL to find the ID of the latest Tranco list from
+const TrancoLatestIDURL string = "https://tranco-list.eu/top-1m-id"
+
+// URL format string to download a Tranco list from. The %s will be replaced
+// with the list ID, either as specified in the call to SetListID or the ID of
+// the latest list.
+const TrancoListURL string = "https://tranco-list.eu/download/%s/1000000"
+
+func init() {
+	RegisterSource(Source{
+		Name:    "tranco",
+		Options: []string{"list-id"},
+		Variant: "list-id",
+		New: func(options map[string]string) (TestList, error) {
+			l := new(TrancoList)
+			if options["list-id"] != "" {
+				l.SetListID(options["list-id"])
+			}
+			l.SetFilename(options[FileOption])
+			return l, nil
+		},
+	})
+}
+
+func (l *TrancoList) SetFilename(filename string) {
+	l.filename = filename
+}
+
+// The SetListID method pins the Tranco list to use to a specific list ID, so
+// that runs are reproducible and citable. List IDs can be found at
+// https://tranco-list.eu/. If no list ID is set, the latest list is used.
+//
+// When reading the list from a file, the list ID may also be set so that it
+// is recorded in the jobs.
+func (l *TrancoList) SetListID(listID string) {
+	var err error
+	l.listID, err = parseTrancoListID(listID)
+	if err != nil {
+		panic("Tranco list ID must be alphanumeric.")
+	}
+}
+
+// Normalises a Tranco list ID, returning an error if it is not alphanumeric.
+func parseTrancoListID(listID string) (string, error) {
+	listID = strings.ToUpper(strings.TrimSpace(listID))
+	if listID == "" {
+		return "", errors.New("empty Tranco list ID")
+	}
+	for _, c := range listID {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return "", fmt.Errorf("invalid Tranco list ID: %q", listID)
+		}
+	}
+	return listID, nil
+}
+
+func (l *TrancoList) FeedJobs(jobs chan map[string]interface{}) {
+	feedJobs(l, jobs)
+}
+
+// The Feed method submits a job for each domain in the list. When the ID of
+// the list is known, it is recorded in the "tranco_list_id" field of each
+// job.
+func (l *TrancoList) Feed(ctx context.Context, jobs chan map[string]interface{}) error {
+	var trancoList *CSVList
+
+	if l.filename == "" {
+		if l.listID == "" {
+			latestID, source, err := getReaderFromSource("tranco-id")
+			if err != nil {
+				return fmt.Errorf("unable to get <%s>: %s", source, err)
+			}
+			body, _ := io.ReadAll(latestID)
+			l.listID, err = parseTrancoListID(string(body))
+			if err != nil {
+				return err
+			}
+		}
+		urlReader, source, err := getReaderFromSource("tranco", l.listID)
+		if err != nil {
+			return fmt.Errorf("unable to get <%s>: %s", source, err)
+		}
+
+		trancoList = CSVListFromReader(urlReader)
+	} else {
+		var err error
+		trancoList, err = OpenCSVList(l.filename)
+		if err != nil {
+			return err
+		}
+	}
+
+	trancoList.SetHeader([]string{"rank", "domain"})
+	if l.listID == "" {
+		return trancoList.Feed(ctx, jobs)
+	}
+	return feedThrough(ctx, trancoList, func(job map[string]interface{}) error {
+		job["tranco_list_id"] = l.listID
+		return sendJob(ctx, jobs, job)
+	})
+}
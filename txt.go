@@ -0,0 +1,162 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// A TextList handles input in plain text format, with one entry per line.
+// Each entry may be a domain name, a URL, or a host and port in the form
+// "host:port" or "[address]:port" for IPv6 addresses. Blank lines are
+// ignored, as is anything following a "#" at the start of a line or after
+// whitespace.
+//
+// Where a port is given, either explicitly or in a URL, it is added to the
+// job in the "port" field so that it can be used by PATHspider.
+type TextList struct {
+	TestList
+	reader io.Reader
+}
+
+func init() {
+	RegisterSource(Source{
+		Name: "txt",
+		New: func(options map[string]string) (TestList, error) {
+			if err := requireFile("txt", options); err != nil {
+				return nil, err
+			}
+			return OpenTextList(options[FileOption])
+		},
+	})
+}
+
+// The OpenTextList function creates a TextList reading from the named file,
+// or from standard input if the filename is "-".
+func OpenTextList(filename string) (*TextList, error) {
+	f, err := openFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return TextListFromReader(f), nil
+}
+
+func TextListFromReader(reader io.Reader) *TextList {
+	l := new(TextList)
+	l.reader = reader
+	return l
+}
+
+func (l *TextList) FeedJobs(jobs chan map[string]interface{}) {
+	feedJobs(l, jobs)
+}
+
+// The Feed method submits a job for each entry in the text. Input compressed
+// with gzip, bzip2, xz, zstd or zip is decompressed transparently.
+func (l *TextList) Feed(ctx context.Context, jobs chan map[string]interface{}) error {
+	if l.reader == nil {
+		return errors.New("TextList not initialised with a reader")
+	}
+	decompressed, err := decompressReader(l.reader)
+	if err != nil {
+		return fmt.Errorf("error decompressing the text: %s", err)
+	}
+	scanner := bufio.NewScanner(decompressed)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := stripTextComment(scanner.Text())
+		if line == "" {
+			continue
+		}
+		job, err := parseTextEntry(line)
+		if err != nil {
+			return fmt.Errorf("error reading the text: line %d: %s", lineNumber, err)
+		}
+		err = sendJob(ctx, jobs, job)
+		if err != nil {
+			return err
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return fmt.Errorf("error reading the text: %s", err)
+	}
+	return nil
+}
+
+// Removes a comment and surrounding whitespace from a line. A comment starts
+// with a "#" at the start of the line or following whitespace, so that a "#"
+// in the fragment of a URL is not taken as a comment.
+func stripTextComment(line string) string {
+	for idx, c := range line {
+		if c == '#' && (idx == 0 || line[idx-1] == ' ' || line[idx-1] == '\t') {
+			line = line[:idx]
+			break
+		}
+	}
+	return strings.TrimSpace(line)
+}
+
+// Creates a job from an entry in a text list.
+func parseTextEntry(entry string) (map[string]interface{}, error) {
+	job := make(map[string]interface{})
+
+	if strings.Contains(entry, "://") {
+		u, err := url.Parse(entry)
+		if err != nil {
+			return nil, err
+		}
+		if u.Hostname() == "" {
+			return nil, fmt.Errorf("no host in URL: %s", entry)
+		}
+		job["url"] = entry
+		job["domain"] = u.Hostname()
+		if u.Port() != "" {
+			port, err := parsePort(u.Port())
+			if err != nil {
+				return nil, err
+			}
+			job["port"] = port
+		}
+		return job, nil
+	}
+
+	// Anything after the host and port, such as a path, is ignored
+	if idx := strings.IndexAny(entry, "/?"); idx >= 0 {
+		entry = entry[:idx]
+	}
+
+	host := entry
+	if strings.HasPrefix(entry, "[") || strings.Count(entry, ":") == 1 {
+		var port string
+		var err error
+		host, port, err = net.SplitHostPort(entry)
+		if err != nil {
+			return nil, err
+		}
+		job["port"], err = parsePort(port)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if host == "" {
+		return nil, fmt.Errorf("no host in entry: %s", entry)
+	}
+	job["domain"] = host
+	return job, nil
+}
+
+// Parses a port number, which must be between 1 and 65535.
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port: %s", s)
+	}
+	return port, nil
+}
@@ -0,0 +1,67 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTextEntry(t *testing.T) {
+	tests := []struct {
+		entry string
+		want  map[string]interface{}
+	}{
+		{"example.com", map[string]interface{}{"domain": "example.com"}},
+		{"example.com/path?q", map[string]interface{}{"domain": "example.com"}},
+		{"example.com:8443", map[string]interface{}{"domain": "example.com", "port": 8443}},
+		{"192.0.2.1:80", map[string]interface{}{"domain": "192.0.2.1", "port": 80}},
+		{"[2001:db8::1]:443", map[string]interface{}{"domain": "2001:db8::1", "port": 443}},
+		{"2001:db8::1", map[string]interface{}{"domain": "2001:db8::1"}},
+		{"https://example.com/a#b", map[string]interface{}{"domain": "example.com", "url": "https://example.com/a#b"}},
+		{"http://example.com:8080/", map[string]interface{}{"domain": "example.com", "url": "http://example.com:8080/", "port": 8080}},
+		{"http://[2001:db8::1]:8080/", map[string]interface{}{"domain": "2001:db8::1", "url": "http://[2001:db8::1]:8080/", "port": 8080}},
+		// Invalid entries
+		{"example.com:0", nil},
+		{"example.com:65536", nil},
+		{"example.com:http", nil},
+		{"[2001:db8::1]", nil},
+		{"[2001:db8::1]:", nil},
+		{":80", nil},
+		{"file:///etc/hosts", nil},
+		{"http://example.com:99999/", nil},
+	}
+	for _, test := range tests {
+		got, err := parseTextEntry(test.entry)
+		if test.want == nil {
+			if err == nil {
+				t.Errorf("parseTextEntry(%q): got %v, want an error", test.entry, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseTextEntry(%q): %s", test.entry, err)
+		} else if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseTextEntry(%q): got %v, want %v", test.entry, got, test.want)
+		}
+	}
+}
+
+func TestStripTextComment(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"example.com", "example.com"},
+		{"  example.com  ", "example.com"},
+		{"# comment", ""},
+		{"example.com # comment", "example.com"},
+		{"example.com\t# comment", "example.com"},
+		{"https://example.com/#fragment", "https://example.com/#fragment"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		got := stripTextComment(test.line)
+		if got != test.want {
+			t.Errorf("stripTextComment(%q): got %q, want %q", test.line, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package hellfire // import "pathspider.net/hellfire"
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Number of random labels that are looked up for each zone. More than one is
+// used so that wildcards answering with a rotating set of addresses are
+// detected.
+const wildcardProbes = 2
+
+type wildcardZone struct {
+	once sync.Once
+	ips  []net.IP
+}
+
+// A WildcardDetector marks results whose addresses match the response to a
+// wildcard record. For each registrable domain seen, random non-existent
+// labels under that domain are looked up once and the addresses returned are
+// remembered. Results for names below the registrable domain whose address
+// is among those are output with the "hellfire_wildcard" field set to true.
+//
+// This stops parking pages and similar catch-all services from being
+// measured as if they were the real service for a name.
+//
+// When used with PerformLookupsContext, the probes query only the address
+// family being looked up and count towards the rate limit. Only results of
+// "host" lookups are checked, as the addresses of name servers and mail
+// exchangers are not answered by wildcards under the input domain.
+type WildcardDetector struct {
+	ResultFilter
+	lock        sync.Mutex
+	zones       map[string]*wildcardZone
+	lookupType  string
+	family      string
+	rateLimiter <-chan time.Time
+}
+
+func (d *WildcardDetector) setLookupOptions(options LookupOptions, rateLimiter <-chan time.Time) {
+	d.lookupType = options.LookupType
+	d.family = options.Family
+	d.rateLimiter = rateLimiter
+}
+
+// Returns the addresses that wildcard records in the zone resolve to, looking
+// these up the first time the zone is seen.
+func (d *WildcardDetector) wildcardAddresses(zone string) []net.IP {
+	d.lock.Lock()
+	if d.zones == nil {
+		d.zones = make(map[string]*wildcardZone)
+	}
+	z, ok := d.zones[zone]
+	if !ok {
+		z = new(wildcardZone)
+		d.zones[zone] = z
+	}
+	d.lock.Unlock()
+
+	network := "ip"
+	if d.family != "" {
+		network = familyNetworks[d.family]
+	}
+	z.once.Do(func() {
+		for i := 0; i < wildcardProbes; i++ {
+			if d.rateLimiter != nil {
+				<-d.rateLimiter
+			}
+			ips, _ := net.DefaultResolver.LookupIP(context.Background(),
+				network, randomLabel()+"."+zone)
+			z.ips = append(z.ips, ips...)
+		}
+	})
+	return z.ips
+}
+
+// Returns a random label that is very unlikely to exist in any zone.
+func randomLabel() string {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+	return "hellfire-" + hex.EncodeToString(b)
+}
+
+func (d *WildcardDetector) FilterResult(result map[string]interface{}, ip net.IP) bool {
+	if d.lookupType != "" && d.lookupType != "host" {
+		return true
+	}
+	domain, ok := result["domain"].(string)
+	if !ok {
+		return true
+	}
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	zone, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	if err != nil || zone == domain {
+		// The apex of a zone cannot be answered by a wildcard
+		return true
+	}
+	for _, wildcardIP := range d.wildcardAddresses(zone) {
+		if wildcardIP.Equal(ip) {
+			result["hellfire_wildcard"] = true
+			break
+		}
+	}
+	return true
+}